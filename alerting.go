@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/Stogas/feedback-api/internal/alerting"
+	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/Stogas/feedback-api/internal/mail"
+	"gorm.io/gorm"
+)
+
+// initAlerting sets up the evaluation of alerting rules if a rules file is configured, returning nil otherwise
+func initAlerting(conf config.AlertingConfig, smtpConf config.SMTPConfig, db *gorm.DB, live *liveConfig, transport http.RoundTripper) *alerting.Engine {
+	if conf.RulesFile == "" {
+		slog.Info("ALERT_RULES_FILE is not set, alerting is disabled")
+		return nil
+	}
+
+	rules, err := alerting.LoadRules(conf.RulesFile)
+	if err != nil {
+		slog.Error("Failed to load alerting rules", "error", err, "file", conf.RulesFile)
+		panic("failed to load alerting rules")
+	}
+
+	var notifiers []alerting.Notifier
+	if conf.Log {
+		notifiers = append(notifiers, alerting.LogNotifier{})
+	}
+	if conf.WebhookURL != "" {
+		webhook := alerting.NewWebhookNotifier(conf.WebhookURL, transport)
+		live.onSecretsReload(func(conf *config.Config) { webhook.SetURL(conf.Alerting.WebhookURL) })
+		notifiers = append(notifiers, webhook)
+	}
+	if len(conf.EmailTo) > 0 {
+		sender, err := mail.NewSender(smtpConf)
+		if err != nil {
+			slog.Error("Failed to set up alert emails", "error", err)
+			panic("failed to set up alert emails")
+		}
+		live.onSecretsReload(func(conf *config.Config) { sender.SetPassword(conf.SMTP.Password) })
+		notifiers = append(notifiers, &alerting.EmailNotifier{Sender: sender, To: conf.EmailTo})
+	}
+
+	for _, rule := range rules {
+		for _, name := range rule.Notifiers {
+			if !slices.ContainsFunc(notifiers, func(n alerting.Notifier) bool { return n.Name() == name }) {
+				slog.Warn("Alerting rule refers to a notifier which is not configured", "alertRule", rule.Name, "notifier", name)
+			}
+		}
+	}
+
+	slog.Info("Alerting is enabled", "rules", len(rules), "notifiers", len(notifiers), "interval", conf.EvaluationInterval)
+	return alerting.NewEngine(db, rules, notifiers, conf.RepeatInterval)
+}
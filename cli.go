@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/apikeys"
+	"github.com/Stogas/feedback-api/internal/config"
+	"gorm.io/gorm"
+)
+
+const cliUsage = `Usage: feedback-api [command]
+
+Without a command, the API is started.
+
+Commands:
+  config validate
+  config print [-redacted | -show-secrets]
+  keys create -name <name> -role <reader|exporter|admin> [-expires-in <duration>]
+  keys list
+  keys revoke <id>
+`
+
+// errUsage is returned by commands invoked with wrong arguments, after the usage is printed
+var errUsage = errors.New("invalid usage")
+
+// runCommand runs a CLI command, returning the process exit code
+func runCommand(args []string) int {
+	var err error
+	switch {
+	case len(args) >= 2 && args[0] == "config":
+		err = runConfigCommand(args[1], args[2:])
+	case len(args) >= 2 && args[0] == "keys":
+		// only the database settings are needed, the rest may not be set where keys are managed
+		var conf config.DBConfig
+		if conf, err = config.LoadDatabase(); err == nil {
+			err = runKeysCommand(conf, args[1], args[2:])
+		}
+	default:
+		err = errUsage
+	}
+
+	var configErrs config.Errors
+	if errors.Is(err, errUsage) {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	} else if errors.As(err, &configErrs) {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:")
+		for _, e := range configErrs {
+			fmt.Fprintln(os.Stderr, "  -", e)
+		}
+		return 1
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+func runConfigCommand(command string, args []string) error {
+	switch command {
+	case "validate":
+		if len(args) > 0 {
+			return errUsage
+		}
+		if _, err := config.New(); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Configuration is valid")
+		return nil
+	case "print":
+		flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+		// secrets are redacted by default, -redacted only makes it explicit
+		redacted := flags.Bool("redacted", false, "redact passwords, tokens and other secrets (the default)")
+		showSecrets := flags.Bool("show-secrets", false, "show passwords, tokens and other secrets instead of redacting them")
+		if err := flags.Parse(args); err != nil || flags.NArg() > 0 || (*redacted && *showSecrets) {
+			return errUsage
+		}
+		// an invalid configuration is printed too, as it helps finding what's wrong
+		_, values, err := config.Load()
+		printConfig(values, *showSecrets)
+		return err
+	}
+	return errUsage
+}
+
+// printConfig prints the resolved values in the environment variable format, along with where they were set.
+// Secrets are redacted unless showSecrets is set, so that the output can be shared
+func printConfig(values []config.Value, showSecrets bool) {
+	if file := os.Getenv(config.FileEnvVar); file != "" {
+		fmt.Printf("# %s=%s\n", config.FileEnvVar, file)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, v := range values {
+		value := v.Value
+		if !showSecrets && v.Secret && value != "" {
+			value = "<redacted>"
+		}
+		source := v.Source
+		if v.File != "" {
+			source += " " + v.File
+		}
+		fmt.Fprintf(w, "%s=%s\t# %s\n", v.Name, value, source)
+	}
+	w.Flush()
+}
+
+func runKeysCommand(conf config.DBConfig, command string, args []string) error {
+	var run func(connect func() (*gorm.DB, error), args []string) error
+	switch command {
+	case "create":
+		run = createKeyCommand
+	case "list":
+		run = listKeysCommand
+	case "revoke":
+		run = revokeKeyCommand
+	default:
+		return errUsage
+	}
+
+	// commands connect after validating their arguments
+	connect := func() (*gorm.DB, error) {
+		db, err := openDB(conf)
+		if err != nil {
+			return nil, err
+		}
+		if err := waitForDB(context.Background(), db, 0); err != nil {
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		// the API may not have been started against this database yet
+		if err := dbMigrate(db, conf.MetadataIndexKeys); err != nil {
+			return nil, fmt.Errorf("DB migrations failed: %w", err)
+		}
+		return db, nil
+	}
+	return run(connect, args)
+}
+
+func createKeyCommand(connect func() (*gorm.DB, error), args []string) error {
+	flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+	name := flags.String("name", "", "what or who the key is for")
+	role := flags.String("role", "", "one of "+strings.Join(apikeys.Roles, ", "))
+	expiresIn := flags.Duration("expires-in", 0, "how long the key is valid, forever if 0")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		return errUsage
+	}
+
+	var expiresAt *time.Time
+	if *expiresIn > 0 {
+		t := time.Now().Add(*expiresIn)
+		expiresAt = &t
+	}
+	if strings.TrimSpace(*name) == "" {
+		return apikeys.ErrEmptyName
+	}
+	if !apikeys.ValidRole(*role) {
+		return apikeys.ErrInvalidRole
+	}
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	key, apiKey, err := apikeys.Create(db, *name, *role, expiresAt)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Created API key %d (%s) with the %s role. It won't be shown again:\n", apiKey.ID, apiKey.Name, apiKey.Role)
+	fmt.Println(key)
+	return nil
+}
+
+func listKeysCommand(connect func() (*gorm.DB, error), args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	keys, err := apikeys.List(db)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tROLE\tCREATED\tEXPIRES\tLAST USED\tSTATUS")
+	for _, k := range keys {
+		status := "active"
+		if k.RevokedAt != nil {
+			status = "revoked"
+		} else if !apikeys.Usable(k) {
+			status = "expired"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s…\t%s\t%s\t%s\t%s\t%s\n",
+			k.ID, k.Name, k.Prefix, k.Role, formatCLITime(&k.CreatedAt), formatCLITime(k.ExpiresAt), formatCLITime(k.LastUsedAt), status)
+	}
+	return w.Flush()
+}
+
+func revokeKeyCommand(connect func() (*gorm.DB, error), args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := strconv.ParseUint(args[0], 10, 0)
+	if err != nil {
+		return errUsage
+	}
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	apiKey, err := apikeys.Revoke(db, uint(id))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Revoked API key %d (%s)\n", apiKey.ID, apiKey.Name)
+	return nil
+}
+
+func formatCLITime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
@@ -5,9 +5,17 @@ import (
 	"fmt"
 	"log/slog"
 	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/Stogas/feedback-api/internal/issues"
 	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/reports"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	slogGorm "github.com/orandin/slog-gorm"
 	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
 	"go.opentelemetry.io/otel"
@@ -15,30 +23,101 @@ import (
 	"gorm.io/gorm"
 )
 
-func initDB(conf config.DBConfig, tracing bool, issues []string) *gorm.DB {
-	// create connection config
-	postgresConfig := postgres.New(postgres.Config{
-		DSN: fmt.Sprintf( // data source name, refer https://github.com/jackc/pgx
-			"host=%s user=%s password=%s dbname=%s port=%v sslmode=disable TimeZone=UTC",
-			conf.Host,
-			conf.User,
-			conf.Password,
-			conf.Name,
-			conf.Port,
-		),
-		PreferSimpleProtocol: true, // disables implicit prepared statement usage. By default pgx automatically uses the extended protocol
-	})
+// dbPassword is the password of new database connections, which may be changed by a config reload
+var dbPassword atomic.Pointer[string]
+
+// postgresDSN returns the data source name without the password, refer https://github.com/jackc/pgx
+func postgresDSN(conf config.DBConfig) string {
+	if conf.URL != "" {
+		return conf.URL
+	}
+
+	params := []string{
+		"host=" + dsnValue(conf.Host),
+		"port=" + strconv.Itoa(conf.Port),
+		"user=" + dsnValue(conf.User),
+		"dbname=" + dsnValue(conf.Name),
+		"sslmode=" + dsnValue(conf.SSLMode),
+	}
+	if conf.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+dsnValue(conf.SSLRootCert))
+	}
+	if conf.SSLCert != "" {
+		params = append(params, "sslcert="+dsnValue(conf.SSLCert), "sslkey="+dsnValue(conf.SSLKey))
+	}
+	return strings.Join(params, " ")
+}
+
+// dsnValue quotes a value of a keyword/value connection string
+func dsnValue(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// postgresConnConfig returns the config of a new connection, with the current password
+func postgresConnConfig(conf config.DBConfig) (*pgx.ConnConfig, error) {
+	connConfig, err := pgx.ParseConfig(postgresDSN(conf))
+	if err != nil {
+		// pgx redacts the password of the connection string in the error
+		return nil, fmt.Errorf("invalid Postgres connection settings: %w", err)
+	}
+	setConnPassword(connConfig)
+
+	connConfig.RuntimeParams["timezone"] = "UTC"
+	if conf.ApplicationName != "" {
+		connConfig.RuntimeParams["application_name"] = conf.ApplicationName
+	}
+	if conf.StatementTimeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(conf.StatementTimeout.Milliseconds(), 10)
+	}
+	return connConfig, nil
+}
+
+// setConnPassword sets the current password, unless there is none and the password is part of POSTGRES_URL
+func setConnPassword(connConfig *pgx.ConnConfig) {
+	if password := *dbPassword.Load(); password != "" {
+		connConfig.Password = password
+	}
+}
+
+// openDB connects to the database, without migrating it
+func openDB(conf config.DBConfig) (*gorm.DB, error) {
+	dbPassword.Store(&conf.Password)
+	connConfig, err := postgresConnConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	// disables implicit prepared statement usage. By default pgx automatically uses the extended protocol
+	connConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+
+	// create connection config, connections opened later (e.g. after the DB restarted) use the password of the latest reload
+	sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(_ context.Context, c *pgx.ConnConfig) error {
+		setConnPassword(c)
+		return nil
+	}))
+	sqlDB.SetMaxOpenConns(conf.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(conf.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(conf.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(conf.ConnMaxIdleTime)
+	postgresConfig := postgres.New(postgres.Config{Conn: sqlDB})
 
 	// set up logging
 	gormLogger := slogGorm.New()
 
-	// connect to database
-	db, err := gorm.Open(postgresConfig, &gorm.Config{
+	// connections are opened on first use, see waitForDB
+	return gorm.Open(postgresConfig, &gorm.Config{
 		Logger: gormLogger,
+		// allows detecting unique constraint violations with gorm.ErrDuplicatedKey
+		TranslateError:       true,
+		DisableAutomaticPing: true,
 	})
+}
+
+// initDB sets up the database handle, without connecting yet
+func initDB(conf config.DBConfig, tracing bool) *gorm.DB {
+	db, err := openDB(conf)
 	if err != nil {
-		slog.Error("Failed to connect to database", "host", conf.Host, "port", conf.Port, "user", conf.User, "database", conf.Name)
-		panic("failed to connect database")
+		slog.Error("Invalid database settings", "error", err, "host", conf.Host, "port", conf.Port, "user", conf.User, "database", conf.Name)
+		panic("invalid database settings")
 	}
 
 	// set up tracing
@@ -48,40 +127,94 @@ func initDB(conf config.DBConfig, tracing bool, issues []string) *gorm.DB {
 			slog.Error("Failed to initialize GORM OTLP instrumentation", "error", err)
 			panic("failed to initialize GORM OTLP instrumentation")
 		}
+	}
+	return db
+}
 
-		// apply migrations within a trace context
-		dbMigrateWithTracing(db)
+// waitForDB pings the database until it's reachable, retrying with backoff for up to maxWait or until ctx is canceled,
+// so that the API doesn't crash-loop while the database is (re)starting
+func waitForDB(ctx context.Context, db *gorm.DB, maxWait time.Duration) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
 
-		// prefill issue types from config within a trace context
-		fillDBWithIssueTypesTracing(db, issues)
+	deadline := time.Now().Add(maxWait)
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := sqlDB.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		wait := min(backoff, time.Until(deadline))
+		if wait <= 0 {
+			return fmt.Errorf("database not reachable within %s: %w", maxWait, err)
+		}
+		slog.Warn("Database not reachable yet, retrying", "error", err, "attempt", attempt, "retryIn", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
+
+// prepareDB waits for the database, then migrates it and syncs the issue types.
+// It returns false if ctx is canceled by a shutdown while waiting.
+func prepareDB(ctx context.Context, db *gorm.DB, conf config.DBConfig, tracing bool, issueTypes []string, issueTypesMode string, ready *readiness) bool {
+	if err := waitForDB(ctx, db, conf.StartupMaxWait); err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		slog.Error("Failed to connect to database", "error", err, "host", conf.Host, "port", conf.Port, "user", conf.User, "database", conf.Name)
+		panic("failed to connect database")
+	}
+	slog.Info("Connected to database")
+
+	if tracing {
+		// apply migrations within a trace context
+		dbMigrateWithTracing(db, conf.MetadataIndexKeys)
 	} else {
 		// apply migrations without tracing
-		err := dbMigrate(db)
+		err := dbMigrate(db, conf.MetadataIndexKeys)
 		if err != nil {
 			slog.Error("DB Migrations failed", "error", err)
 			panic("DB migrations failed")
 		}
+	}
+	ready.migrated.Store(true)
 
+	if tracing {
+		// prefill issue types from config within a trace context
+		fillDBWithIssueTypesTracing(db, issueTypes, issueTypesMode)
+	} else {
 		// prefill issue types from config without tracing
-		err = fillDBWithIssueTypes(db, issues)
+		err := syncIssueTypes(db, issueTypes, issueTypesMode)
 		if err != nil {
 			slog.Error("DB issue type prefill failed", "error", err)
 			panic("DB issue type prefill failed")
 		}
 	}
-
-	return db
+	ready.issueTypesLoaded.Store(true)
+	return true
 }
 
 // the db...Tracing() functions are definitely not ideal and
 // result in some duplicate work in them and in initDB(), but
 // let's deal with that later
 
-func dbMigrateWithTracing(db *gorm.DB) {
+func dbMigrateWithTracing(db *gorm.DB, metadataIndexKeys []string) {
 	ctx, span := otel.Tracer("GORM-auto-migrations").Start(context.Background(), "Run DB migrations")
 	logger := slog.With("traceId", span.SpanContext().TraceID(), "spanId", span.SpanContext().SpanID())
 	logger.Info("Running DB migrations ...")
-	mErr := dbMigrate(db.WithContext(ctx))
+	mErr := dbMigrate(db.WithContext(ctx), metadataIndexKeys)
 	if mErr != nil {
 		span.RecordError(mErr)
 		logger.Error("DB Migrations failed", "error", mErr)
@@ -92,18 +225,29 @@ func dbMigrateWithTracing(db *gorm.DB) {
 	span.End()
 }
 
-func dbMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+func dbMigrate(db *gorm.DB, metadataIndexKeys []string) error {
+	err := db.AutoMigrate(
 		&models.Issue{},
 		&models.Report{},
+		&models.APIKey{},
+		&models.IdempotencyKey{},
+		&models.SignatureNonce{},
+		&models.Alert{},
+		&models.DigestRun{},
 	)
+	if err != nil {
+		return err
+	}
+
+	// expression indexes for metadata keys promoted in config
+	return reports.SyncMetadataIndexes(db, metadataIndexKeys)
 }
 
-func fillDBWithIssueTypesTracing(db *gorm.DB, issues []string) {
+func fillDBWithIssueTypesTracing(db *gorm.DB, issueTypes []string, issueTypesMode string) {
 	ctx, span := otel.Tracer("GORM-issue-loading").Start(context.Background(), "Fill DB with issue types")
 	logger := slog.With("traceId", span.SpanContext().TraceID(), "spanId", span.SpanContext().SpanID())
 	logger.Info("Filling DB with provided issue types ...")
-	mErr := fillDBWithIssueTypes(db.WithContext(ctx), issues)
+	mErr := syncIssueTypes(db.WithContext(ctx), issueTypes, issueTypesMode)
 	if mErr != nil {
 		span.RecordError(mErr)
 		logger.Error("DB issue type prefill failed", "error", mErr)
@@ -114,18 +258,55 @@ func fillDBWithIssueTypesTracing(db *gorm.DB, issues []string) {
 	span.End()
 }
 
-func fillDBWithIssueTypes(db *gorm.DB, typesFromConfig []string) error {
-	// get existing issues in DB
+// issueSyncLockID is the Postgres advisory lock serializing issue type syncs of replicas starting or reloading at once
+const issueSyncLockID = 0x66656564
+
+// syncIssueTypes syncs the issue types from config in a transaction, so that a failed sync leaves them as they were
+func syncIssueTypes(db *gorm.DB, typesFromConfig []string, mode string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", issueSyncLockID).Error; err != nil {
+			return err
+		}
+		return fillDBWithIssueTypes(tx, typesFromConfig, mode)
+	})
+}
+
+func fillDBWithIssueTypes(db *gorm.DB, typesFromConfig []string, mode string) error {
+	// get existing issues in DB, including deleted ones which may be restored
 	var existingIssues []models.Issue
-	err := db.Find(&existingIssues).Error
+	err := db.Unscoped().Order("id").Find(&existingIssues).Error
 	if err != nil && err != gorm.ErrRecordNotFound {
 		slog.Error("Failed to fetch existing issue types", "error", err)
 		return err
 	}
 
+	if mode == issues.ModeAPI {
+		return seedIssueTypes(db, existingIssues, typesFromConfig)
+	}
+	return syncEnvIssueTypes(db, existingIssues, typesFromConfig)
+}
+
+// seedIssueTypes creates the issue types from config in an empty DB, as those managed through the API are only seeded
+func seedIssueTypes(db *gorm.DB, existingIssues []models.Issue, typesFromConfig []string) error {
+	if len(existingIssues) > 0 {
+		slog.Info("Issue types are managed through the API, ignoring ISSUE_TYPES")
+		return nil
+	}
+	for i, typeName := range typesFromConfig {
+		if _, err := issues.Create(db, typeName, i); err != nil {
+			slog.Error("Failed to create issue type", "issueName", typeName, "error", err)
+			return err
+		}
+		slog.Info("Created new issue type", "issueName", typeName)
+	}
+	return nil
+}
+
+// syncEnvIssueTypes makes the issue types in DB match those from config, when they're managed through the environment
+func syncEnvIssueTypes(db *gorm.DB, existingIssues []models.Issue, typesFromConfig []string) error {
 	// delete issue types not present in config from DB
 	for _, existingIssue := range existingIssues {
-		if !slices.Contains(typesFromConfig, existingIssue.Name) {
+		if !existingIssue.DeletedAt.Valid && !slices.Contains(typesFromConfig, existingIssue.Name) {
 			if err := db.Delete(&existingIssue).Error; err != nil {
 				slog.Error("Failed to mark existing issue not present in config as deleted", "issueName", existingIssue.Name)
 				return err
@@ -135,19 +316,37 @@ func fillDBWithIssueTypes(db *gorm.DB, typesFromConfig []string) error {
 		}
 	}
 
-	// create any new issue types from config
-	var existingTypesSlice []string
-	for _, issue := range existingIssues {
-		existingTypesSlice = append(existingTypesSlice, issue.Name)
-	}
-	for _, typeName := range typesFromConfig {
-		if !slices.Contains(existingTypesSlice, typeName) {
-			newType := models.Issue{Name: typeName}
-			if err := db.Create(&newType).Error; err != nil {
-				slog.Error("Failed to create issue type", "issueName", newType.Name, "error", err)
+	// create any new issue types from config, restoring deleted ones with the same name so that their reports stay linked,
+	// and order them as in config
+	for i, typeName := range typesFromConfig {
+		idx := slices.IndexFunc(existingIssues, func(issue models.Issue) bool {
+			return issue.Name == typeName && !issue.DeletedAt.Valid
+		})
+		if idx == -1 {
+			idx = slices.IndexFunc(existingIssues, func(issue models.Issue) bool { return issue.Name == typeName })
+		}
+
+		if idx == -1 {
+			if _, err := issues.Create(db, typeName, i); err != nil {
+				slog.Error("Failed to create issue type", "issueName", typeName, "error", err)
+				return err
+			}
+			slog.Info("Created new issue type", "issueName", typeName)
+			continue
+		}
+
+		existingIssue := existingIssues[idx]
+		if existingIssue.DeletedAt.Valid {
+			if _, err := issues.Restore(db, existingIssue.ID); err != nil {
+				slog.Error("Failed to restore issue type", "issueName", typeName, "error", err)
+				return err
+			}
+			slog.Info("Restored deleted issue type", "issueName", typeName)
+		}
+		if existingIssue.Position != i {
+			if _, err := issues.Update(db, existingIssue.ID, nil, &i); err != nil {
+				slog.Error("Failed to reorder issue type", "issueName", typeName, "error", err)
 				return err
-			} else {
-				slog.Info("Created new issue type", "issueName", newType.Name)
 			}
 		}
 	}
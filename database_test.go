@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/config"
+)
+
+func TestPostgresDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.DBConfig
+		want string
+	}{
+		{
+			name: "settings",
+			conf: config.DBConfig{Host: "db", Port: 5432, User: "feedback", Name: "feedback", SSLMode: "disable"},
+			want: "host='db' port=5432 user='feedback' dbname='feedback' sslmode='disable'",
+		},
+		{
+			name: "quoted values",
+			conf: config.DBConfig{Host: "db", Port: 5432, User: `o'brien`, Name: `a b\c`, SSLMode: "disable"},
+			want: `host='db' port=5432 user='o\'brien' dbname='a b\\c' sslmode='disable'`,
+		},
+		{
+			name: "TLS",
+			conf: config.DBConfig{Host: "db", Port: 5432, SSLMode: "verify-full", SSLRootCert: "/ca.crt", SSLCert: "/tls.crt", SSLKey: "/tls.key"},
+			want: "host='db' port=5432 user='' dbname='' sslmode='verify-full' sslrootcert='/ca.crt' sslcert='/tls.crt' sslkey='/tls.key'",
+		},
+		{
+			name: "URL",
+			conf: config.DBConfig{Host: "db", URL: "postgres://feedback@managed.example.com/feedback?sslmode=require"},
+			want: "postgres://feedback@managed.example.com/feedback?sslmode=require",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postgresDSN(tt.conf); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresConnConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		conf         config.DBConfig
+		password     string
+		wantPassword string
+	}{
+		{"password", config.DBConfig{Host: "db", Port: 5432, SSLMode: "disable"}, "s3cret", "s3cret"},
+		{"password of the URL", config.DBConfig{URL: "postgres://feedback:fromurl@db/feedback?sslmode=disable"}, "", "fromurl"},
+		{"password overriding the URL", config.DBConfig{URL: "postgres://feedback:fromurl@db/feedback?sslmode=disable"}, "s3cret", "s3cret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPassword.Store(&tt.password)
+			tt.conf.ApplicationName = "feedback-api"
+			tt.conf.StatementTimeout = 30 * time.Second
+
+			connConfig, err := postgresConnConfig(tt.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if connConfig.Password != tt.wantPassword {
+				t.Errorf("got password %q, want %q", connConfig.Password, tt.wantPassword)
+			}
+			params := connConfig.RuntimeParams
+			if params["timezone"] != "UTC" || params["application_name"] != "feedback-api" || params["statement_timeout"] != "30000" {
+				t.Errorf("got runtime params %v", params)
+			}
+		})
+	}
+}
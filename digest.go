@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/Stogas/feedback-api/internal/digest"
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/Stogas/feedback-api/internal/mail"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const codeDigestFailed = "digest_failed"
+
+// initDigests sets up digest emails if a schedule is configured, returning nil otherwise
+func initDigests(conf config.DigestConfig, smtpConf config.SMTPConfig, db *gorm.DB, live *liveConfig) *digest.Mailer {
+	if conf.Schedule == "" {
+		slog.Info("DIGEST_SCHEDULE is not set, digest emails are disabled")
+		return nil
+	}
+
+	schedule, err := digest.ParseSchedule(conf.Schedule, conf.Time, conf.Weekday)
+	if err != nil {
+		slog.Error("Invalid digest schedule", "error", err)
+		panic("invalid digest schedule")
+	}
+	if len(conf.EmailTo) == 0 {
+		slog.Error("DIGEST_EMAIL_TO must be set to send digest emails")
+		panic("missing digest recipients")
+	}
+	sender, err := mail.NewSender(smtpConf)
+	if err != nil {
+		slog.Error("Failed to set up digest emails", "error", err)
+		panic("failed to set up digest emails")
+	}
+	live.onSecretsReload(func(conf *config.Config) { sender.SetPassword(conf.SMTP.Password) })
+	template, err := digest.LoadTemplate(conf.TemplateFile)
+	if err != nil {
+		slog.Error("Failed to load digest template", "error", err, "file", conf.TemplateFile)
+		panic("failed to load digest template")
+	}
+
+	mailer := digest.NewMailer(db, sender, template, schedule, conf.EmailTo, conf.Comments)
+	slog.Info("Digest emails are enabled", "schedule", conf.Schedule, "next", schedule.Next(time.Now()), "recipients", len(conf.EmailTo))
+	return mailer
+}
+
+// sendDigestEndpoint sends the digest of the period ending now, e.g. to try out the template or SMTP settings
+func sendDigestEndpoint(mailer *digest.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := getLogger(c.Request.Context())
+
+		if err := mailer.Send(c.Request.Context(), time.Now()); err != nil {
+			logger.Error("Failed to send digest", "error", err)
+			abortWithProblem(c, http.StatusInternalServerError, codeDigestFailed, "Failed to send digest")
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.DigestResponse{Recipients: mailer.Recipients()})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+const codePreconditionFailed = "precondition_failed"
+
+var errMalformedETag = errors.New("malformed entity tag")
+
+// reportETag formats a report version as a strong entity tag
+func reportETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+func setReportETag(c *gin.Context, version int) {
+	c.Header("ETag", reportETag(version))
+}
+
+// ifMatchVersions parses the If-Match header into the report versions it allows.
+// It returns nil if the header is absent or "*", i.e. any version is allowed.
+func ifMatchVersions(c *gin.Context) ([]int, error) {
+	return parseETagVersions(c.GetHeader("If-Match"), false)
+}
+
+// abortWithMalformedETag rejects a request whose conditional header can't be parsed.
+// It's a client error rather than a failed precondition, as there's no version to compare.
+func abortWithMalformedETag(c *gin.Context, header string) {
+	p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "One or more fields are invalid")
+	p.Errors = []dto.FieldError{{Field: header, Code: "etag", Message: `must be "*" or a comma-separated list of entity tags, e.g. "3"`}}
+	abortWithProblemDetails(c, p)
+}
+
+// ifNoneMatchVersions parses the If-None-Match header into the report versions the client already has
+func ifNoneMatchVersions(c *gin.Context) ([]int, error) {
+	return parseETagVersions(c.GetHeader("If-None-Match"), true)
+}
+
+// parseETagVersions parses a comma-separated list of entity tags into report versions,
+// returning nil for an empty list or "*". Weak tags are skipped unless weak comparison is allowed (RFC 9110 8.8.3.2).
+func parseETagVersions(header string, weak bool) ([]int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	versions := []int{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[len("W/"):]
+		}
+		unquoted, err := strconv.Unquote(tag)
+		if err != nil {
+			return nil, errMalformedETag
+		}
+		version, err := strconv.Atoi(unquoted)
+		if err != nil {
+			return nil, errMalformedETag
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var parseETagVersionsTests = []struct {
+	name    string
+	header  string
+	weak    bool
+	want    []int
+	wantErr error
+}{
+	{"absent", "", false, nil, nil},
+	{"any", "*", false, nil, nil},
+	{"single", `"3"`, false, []int{3}, nil},
+	{"list", ` "3", "5" `, false, []int{3, 5}, nil},
+	{"weak skipped", `W/"3", "5"`, false, []int{5}, nil},
+	{"only weak", `W/"3"`, false, []int{}, nil},
+	{"weak allowed", `W/"3", "5"`, true, []int{3, 5}, nil},
+	{"unquoted", `3`, false, nil, errMalformedETag},
+	{"not a version", `"abc"`, false, nil, errMalformedETag},
+	{"empty tag", `"3",`, false, nil, errMalformedETag},
+}
+
+func TestParseETagVersions(t *testing.T) {
+	for _, tt := range parseETagVersionsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseETagVersions(tt.header, tt.weak)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportETag(t *testing.T) {
+	tag := reportETag(7)
+	if tag != `"7"` {
+		t.Fatalf("got %s", tag)
+	}
+	if versions, err := parseETagVersions(tag, false); err != nil || !slices.Equal(versions, []int{7}) {
+		t.Errorf("ETag doesn't round-trip: %v, %v", versions, err)
+	}
+}
+
+// TestUpdateReportMalformedIfMatch checks that a malformed If-Match is rejected before the report is read
+func TestUpdateReportMalformedIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPatch, "/v1/submit/report", nil)
+	c.Request.Header.Set("If-Match", "3")
+	c.Set("db", (*gorm.DB)(nil))
+	c.Set("report", models.Report{UUID: uuid.New()})
+
+	updateReportEndpoint(c)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var p dto.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("response isn't a problem: %v", err)
+	}
+	if p.Code != codeValidationFailed || len(p.Errors) != 1 || p.Errors[0].Field != "If-Match" {
+		t.Errorf("got %+v", p)
+	}
+}
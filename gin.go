@@ -1,90 +1,127 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
+	"github.com/Stogas/feedback-api/internal/apikeys"
 	"github.com/Stogas/feedback-api/internal/config"
-	"github.com/gin-contrib/cors"
+	"github.com/Stogas/feedback-api/internal/digest"
+	"github.com/Stogas/feedback-api/internal/issues"
+	"github.com/Stogas/feedback-api/internal/sso"
 	"github.com/gin-gonic/gin"
 )
 
-func startAPI(conf config.APIConfig, globalMiddlewares []gin.HandlerFunc, dbMiddleware gin.HandlerFunc) {
+// startAPI runs the API listener in the background, returning its server for shutting it down
+func startAPI(conf config.APIConfig, live *liveConfig, ready *readiness, globalMiddlewares []gin.HandlerFunc, dbMiddleware gin.HandlerFunc, events *reportEvents, digests *digest.Mailer, ssoProvider *sso.Provider) *http.Server {
 	if conf.Debug {
 		gin.SetMode(gin.DebugMode)
 	}
 
+	useJSONFieldNames()
+
 	r := gin.New()
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(notFoundProblem)
+	r.NoMethod(methodNotAllowedProblem)
 
-	r.Use(gin.Recovery())
+	r.Use(gin.CustomRecovery(recoveryProblem))
 
-	corsConfig := cors.DefaultConfig()
-	corsConfig.AllowOrigins = conf.CorsOrigins
-	corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, "X-Feedback-Submit-Token")
-	corsConfig.MaxAge = 1 * time.Hour
-	corsConfig.AllowWildcard = true
-	r.Use(cors.New(corsConfig))
+	// CORS origins may be changed by a config reload
+	r.Use(live.corsMiddleware)
 
 	for _, m := range globalMiddlewares {
 		// slog.Debug("Gin: Adding middleware")
 		r.Use(m)
 	}
 
-	r.GET("/ping", ping)
+	doc, spec := initOpenAPI()
+	var validation []gin.HandlerFunc
+	if conf.OpenAPIValidation {
+		validation = append(validation, openAPIValidationMiddleware(doc))
+	}
 
-	r.GET("/issues", dbMiddleware, GetIssuesEndpoint)
+	r.GET("/ping", ping)
+	r.GET("/healthz", healthEndpoint)
+	r.GET("/readyz", ready.readyEndpoint)
+	r.GET("/openapi.json", openAPIEndpoint(spec))
 
-	rSubmit := r.Group("/submit")
-	rSubmit.Use(
-		submitTokenMiddleware(conf.SubmitToken),
-		dbMiddleware,
-		reportMiddleware,
-	)
-	{
-		rSubmit.POST("/report", submitReportEndpoint)
-		rSubmit.PATCH("/report", updateReportEndpoint)
+	if conf.AdminUIEnabled {
+		addUIRoutes(r, conf, live, dbMiddleware, ssoProvider)
 	}
 
+	addVersionedRoutes(r.Group("/v1"), conf, live, dbMiddleware, validation, events, digests)
+
+	// unversioned routes are kept as deprecated aliases of /v1 for clients which can't be force-upgraded
+	addVersionedRoutes(r.Group("", deprecationMiddleware("/v1", conf.LegacyRoutesDeprecatedAt, conf.LegacyRoutesSunset)), conf, live, dbMiddleware, validation, events, digests)
+
 	slog.Info("Starting API", "host", conf.Host, "port", conf.Port)
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf("%s:%v", conf.Host, conf.Port),
 		Handler: r.Handler(),
 	}
-	// Initializing the server in a goroutine so that
-	// it won't block the graceful shutdown handling below
+	// open streams would otherwise keep the listener from shutting down
+	srv.RegisterOnShutdown(events.broadcaster.Close)
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			slog.Error("API listener failed", "error", err)
 		}
 	}()
-
-	apiGracefulShutdown(srv)
+	return srv
 }
 
-func apiGracefulShutdown(srv *http.Server) {
-	// Graceful shutdown
-	// Wait for interrupt signal to gracefully shutdown the server with timeout
-	timeout := 5 * time.Second
-	quit := make(chan os.Signal, 1)
+// addVersionedRoutes registers all routes which are subject to API versioning
+func addVersionedRoutes(r *gin.RouterGroup, conf config.APIConfig, live *liveConfig, dbMiddleware gin.HandlerFunc, validation []gin.HandlerFunc, events *reportEvents, digests *digest.Mailer) {
+	r.GET("/issues", dbMiddleware, GetIssuesEndpoint)
 
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	slog.Info("Shutting down API listener ...", "timeout", timeout)
+	rSubmit := r.Group("/submit")
+	rSubmit.Use(
+		dbMiddleware,
+		submitTokenMiddleware(live),
+	)
+	rSubmit.Use(validation...)
+	rSubmit.Use(
+		idempotencyMiddleware(conf.IdempotencyKeyTTL),
+	)
+	{
+		rSubmit.POST("/report", reportMiddleware, submitReportEndpoint)
+		rSubmit.PATCH("/report", reportMiddleware, updateReportEndpoint)
+		rSubmit.PUT("/report/:uuid", reportMiddleware, upsertReportEndpoint)
+		rSubmit.GET("/report/:uuid", getReportEndpoint)
+		rSubmit.POST("/reports\\:batch", batchReportsEndpoint(conf.BatchMaxItems, conf.BatchMaxTimestampSkew))
+	}
 
-	// timeout of 5 seconds
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	rAdmin := r.Group("/admin")
+	rAdmin.Use(
+		dbMiddleware,
+		apiKeyMiddleware,
+	)
+	rAdmin.Use(validation...)
+	{
+		rAdmin.GET("/reports", roleMiddleware(apikeys.RoleExporter), listReportsEndpoint)
+		rAdmin.GET("/reports/stats", roleMiddleware(apikeys.RoleReader), reportStatsEndpoint)
+		if digests != nil {
+			rAdmin.POST("/digest/send", roleMiddleware(apikeys.RoleAdmin), sendDigestEndpoint(digests))
+		}
+
+		rAdmin.GET("/issues", roleMiddleware(apikeys.RoleReader), listIssuesEndpoint)
+		rIssues := rAdmin.Group("/issues", roleMiddleware(apikeys.RoleAdmin), issuesAPIModeMiddleware(conf.IssueTypesMode))
+		rIssues.POST("", createIssueEndpoint)
+		rIssues.PATCH("/:id", updateIssueEndpoint)
+		rIssues.DELETE("/:id", issueStateEndpoint(issues.Disable))
+		rIssues.POST("/:id/restore", issueStateEndpoint(issues.Restore))
+	}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		slog.Error("Error while shutting down API listener gracefully. Initiating force shutdown...", "error", err, "timeout", timeout)
-	} else {
-		slog.Info("API listener exited successfully")
+	rStream := r.Group("/stream")
+	rStream.Use(
+		dbMiddleware,
+		apiKeyMiddleware,
+		roleMiddleware(apikeys.RoleExporter),
+	)
+	rStream.Use(validation...)
+	{
+		rStream.GET("/reports", streamReportsEndpoint(events, conf.StreamKeepAlive))
 	}
 }
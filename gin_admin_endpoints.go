@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/reports"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultReportsLimit = 50
+	maxReportsLimit     = 500
+)
+
+func listReportsEndpoint(c *gin.Context) {
+	logger := getLogger(c.Request.Context())
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	filter, err := reports.ParseFilter(c.Request.URL.Query())
+	if err != nil {
+		abortWithProblem(c, http.StatusBadRequest, codeInvalidQuery, err.Error())
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultReportsLimit)))
+	if err != nil || limit < 1 || limit > maxReportsLimit {
+		abortWithProblem(c, http.StatusBadRequest, codeInvalidQuery, "Invalid 'limit', expected a number between 1 and "+strconv.Itoa(maxReportsLimit))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		abortWithProblem(c, http.StatusBadRequest, codeInvalidQuery, "Invalid 'offset', expected a non-negative number")
+		return
+	}
+
+	var found []models.Report
+	if err := filter.Apply(db).Order("created_at DESC").Limit(limit).Offset(offset).Find(&found).Error; err != nil {
+		logger.Error("Failed to fetch reports from DB", "error", err)
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseReadError, "Database read error")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapReportsToAdminReportResponses(found))
+}
+
+func reportStatsEndpoint(c *gin.Context) {
+	logger := getLogger(c.Request.Context())
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	filter, err := reports.ParseFilter(c.Request.URL.Query())
+	if err != nil {
+		abortWithProblem(c, http.StatusBadRequest, codeInvalidQuery, err.Error())
+		return
+	}
+
+	groupBy := c.Query("group_by")
+	if _, err := reports.GroupByExpr(groupBy); err != nil {
+		abortWithProblem(c, http.StatusBadRequest, codeInvalidQuery, err.Error())
+		return
+	}
+
+	stats, err := reports.GetStats(db, filter, groupBy)
+	if err != nil {
+		logger.Error("Failed to aggregate report stats", "error", err, "groupBy", groupBy)
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseReadError, "Database read error")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapStatsToStatsResponse(groupBy, stats))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/Stogas/feedback-api/internal/issues"
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	codeIssueNotFound        = "issue_not_found"
+	codeIssueNameExists      = "issue_name_exists"
+	codeIssueTypesEnvManaged = "issue_types_env_managed"
+	codeInvalidIssueName     = "invalid_issue_name"
+)
+
+// issuesAPIModeMiddleware rejects changes to issue types which would be overwritten by ISSUE_TYPES on the next start
+func issuesAPIModeMiddleware(mode string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if mode != issues.ModeAPI {
+			abortWithProblem(c, http.StatusConflict, codeIssueTypesEnvManaged, "Issue types are managed with ISSUE_TYPES, set ISSUE_TYPES_MODE=api to manage them through the API")
+			return
+		}
+		c.Next()
+	}
+}
+
+func listIssuesEndpoint(c *gin.Context) {
+	logger := getLogger(c.Request.Context())
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	found, err := issues.List(db)
+	if err != nil {
+		logger.Error("Failed to fetch issue types from DB", "error", err)
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseReadError, "Database read error")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapIssuesToAdminIssueResponses(found))
+}
+
+func createIssueEndpoint(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	var req dto.CreateIssueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	issue, err := issues.Create(db, req.Name, req.Position)
+	if err != nil {
+		abortWithIssueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.MapIssueToAdminIssueResponse(issue))
+}
+
+func updateIssueEndpoint(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	id, ok := issueIDParam(c)
+	if !ok {
+		return
+	}
+	var req dto.UpdateIssueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	issue, err := issues.Update(db, id, req.Name, req.Position)
+	if err != nil {
+		abortWithIssueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapIssueToAdminIssueResponse(issue))
+}
+
+// issueStateEndpoint disables or restores an issue type
+func issueStateEndpoint(change func(db *gorm.DB, id uint) (models.Issue, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := c.MustGet("db").(*gorm.DB)
+
+		id, ok := issueIDParam(c)
+		if !ok {
+			return
+		}
+
+		issue, err := change(db, id)
+		if err != nil {
+			abortWithIssueError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, dto.MapIssueToAdminIssueResponse(issue))
+	}
+}
+
+func issueIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "One or more fields are invalid")
+		p.Errors = []dto.FieldError{{Field: "id", Code: "numeric", Message: "must be an issue type ID"}}
+		abortWithProblemDetails(c, p)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func abortWithIssueError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, issues.ErrNotFound):
+		abortWithProblem(c, http.StatusNotFound, codeIssueNotFound, "Issue type not found")
+	case errors.Is(err, issues.ErrNameExists):
+		abortWithProblem(c, http.StatusConflict, codeIssueNameExists, "An enabled issue type with this name already exists")
+	case errors.Is(err, issues.ErrEmptyName):
+		abortWithProblem(c, http.StatusBadRequest, codeInvalidIssueName, "Issue type name must not be blank")
+	default:
+		getLogger(c.Request.Context()).Error("Database write error", "error", err)
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseWriteError, "Database write error")
+	}
+}
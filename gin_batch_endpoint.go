@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/stream"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const codeBatchRolledBack = "batch_rolled_back"
+
+var errBatchRolledBack = errors.New("batch contains items which can't be applied")
+
+// batchState holds what a batch needs to know from the database, so that items are
+// checked with a couple of queries for the whole batch rather than a few per item
+type batchState struct {
+	knownIssues map[int]bool
+	existing    map[uuid.UUID]models.Report
+	now         time.Time
+	maxSkew     time.Duration
+	// stored on created reports
+	tokenLabel string
+}
+
+func batchReportsEndpoint(maxItems int, maxSkew time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := getLogger(c.Request.Context())
+
+		db := c.MustGet("db").(*gorm.DB)
+
+		var req dto.BatchReportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithBindingError(c, err)
+			return
+		}
+		if len(req.Items) > maxItems {
+			p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "One or more fields are invalid")
+			p.Errors = []dto.FieldError{{Field: "items", Code: "max", Message: fmt.Sprintf("must have at most %d items", maxItems)}}
+			abortWithProblemDetails(c, p)
+			return
+		}
+		if req.Mode == "" {
+			req.Mode = dto.BatchModeBestEffort
+		}
+
+		results := make([]dto.BatchItemResult, len(req.Items))
+		var events []stream.Event
+		var err error
+		if req.Mode == dto.BatchModeTransaction {
+			err = db.Transaction(func(tx *gorm.DB) error {
+				events, err = applyBatch(tx, req.Items, results, true, maxSkew, c.GetString("submitToken"))
+				return err
+			})
+		} else {
+			events, err = applyBatch(db, req.Items, results, false, maxSkew, c.GetString("submitToken"))
+		}
+
+		if errors.Is(err, errBatchRolledBack) {
+			p := newProblem(c, http.StatusUnprocessableEntity, codeBatchRolledBack, "Some items can't be applied, so no items were applied")
+			p.Extensions = map[string]any{"results": results}
+			abortWithProblemDetails(c, p)
+			return
+		} else if err != nil {
+			logger.Error("Batch submission failed", "error", err, "mode", req.Mode)
+			abortWithProblem(c, http.StatusInternalServerError, codeDatabaseWriteError, "Database write error")
+			return
+		}
+
+		for _, result := range results {
+			if result.Status == dto.BatchStatusCreated {
+				countReport(c, *result.Report.Satisfied)
+			}
+		}
+		for _, e := range events {
+			publishReportEvent(c, e.Type, e.Report)
+		}
+
+		c.JSON(http.StatusOK, dto.BatchReportResponse{Mode: req.Mode, Results: results})
+	}
+}
+
+// applyBatch applies batch items in order, storing the outcome of each in results and returning the applied changes.
+// If atomic, it returns errBatchRolledBack when any item can't be applied, and stops on the first database error.
+func applyBatch(db *gorm.DB, items []dto.BatchReportItem, results []dto.BatchItemResult, atomic bool, maxSkew time.Duration, tokenLabel string) ([]stream.Event, error) {
+	state, err := loadBatchState(db, items, atomic, maxSkew)
+	if err != nil {
+		return nil, err
+	}
+	state.tokenLabel = tokenLabel
+
+	var events []stream.Event
+	rolledBack := false
+	for i, item := range items {
+		results[i] = state.apply(db, item)
+		results[i].Index = i
+
+		switch results[i].Status {
+		case dto.BatchStatusCreated:
+			events = append(events, stream.Event{Type: stream.EventReportCreated, Report: state.existing[item.UUID]})
+		case dto.BatchStatusUpdated:
+			events = append(events, stream.Event{Type: stream.EventReportUpdated, Report: state.existing[item.UUID]})
+		case dto.BatchStatusFailed:
+			if atomic {
+				return nil, fmt.Errorf("failed to apply batch item %d", i)
+			}
+		default:
+			rolledBack = atomic
+		}
+	}
+
+	if rolledBack {
+		return nil, errBatchRolledBack
+	}
+	return events, nil
+}
+
+func loadBatchState(db *gorm.DB, items []dto.BatchReportItem, lock bool, maxSkew time.Duration) (*batchState, error) {
+	var issueIDs []int
+	var uuids []uuid.UUID
+	for _, item := range items {
+		if item.IssueID != nil {
+			issueIDs = append(issueIDs, *item.IssueID)
+		}
+		uuids = append(uuids, item.UUID)
+	}
+
+	state := &batchState{
+		knownIssues: make(map[int]bool),
+		existing:    make(map[uuid.UUID]models.Report),
+		now:         time.Now(),
+		maxSkew:     maxSkew,
+	}
+
+	if len(issueIDs) > 0 {
+		var issues []models.Issue
+		if err := db.Where("id IN ?", issueIDs).Find(&issues).Error; err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			state.knownIssues[int(issue.ID)] = true
+		}
+	}
+
+	q := db.Where("uuid IN ?", uuids)
+	if lock {
+		q = q.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	var existing []models.Report
+	if err := q.Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	for _, report := range existing {
+		state.existing[report.UUID] = report
+	}
+
+	return state, nil
+}
+
+func (s *batchState) apply(db *gorm.DB, item dto.BatchReportItem) dto.BatchItemResult {
+	result := dto.BatchItemResult{UUID: item.UUID, Status: dto.BatchStatusInvalid}
+
+	if err := binding.Validator.ValidateStruct(&item); err != nil {
+		var validationErrs validator.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			result.Errors = fieldErrors(validationErrs)
+		}
+		return result
+	}
+	if item.IssueID != nil && !s.knownIssues[*item.IssueID] {
+		result.Errors = []dto.FieldError{{Field: "issue_id", Code: "exists", Message: "must refer to a known issue type"}}
+		return result
+	}
+
+	report := models.Report{
+		UUID:       item.UUID,
+		Satisfied:  item.Satisfied,
+		IssueID:    item.IssueID,
+		Comment:    item.Comment,
+		Metadata:   item.Metadata,
+		TokenLabel: s.tokenLabel,
+		Model:      gorm.Model{UpdatedAt: s.timestamp(item.SubmittedAt)},
+	}
+
+	_, exists := s.existing[item.UUID]
+	var err error
+	switch {
+	case item.Operation == dto.BatchOperationCreate && exists:
+		result.Status = dto.BatchStatusConflict
+		return result
+	case item.Operation == dto.BatchOperationCreate:
+		report.CreatedAt = report.UpdatedAt
+		err = db.Create(&report).Error
+		result.Status = dto.BatchStatusCreated
+	case !exists:
+		result.Status = dto.BatchStatusNotFound
+		return result
+	default:
+		report, _, err = saveReportUpdate(db, report, nil)
+		result.Status = dto.BatchStatusUpdated
+	}
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// created concurrently by another request
+		result.Status = dto.BatchStatusConflict
+		return result
+	} else if err != nil {
+		getLogger(db.Statement.Context).Error("Database write error", "error", err, "uuid", item.UUID)
+		result.Status = dto.BatchStatusFailed
+		return result
+	}
+
+	s.existing[report.UUID] = report
+	response := dto.MapReportToReportResponse(report)
+	result.Report = &response
+	return result
+}
+
+// timestamp returns the client-provided submission time if it's within the allowed skew, or the current time
+func (s *batchState) timestamp(submittedAt *time.Time) time.Time {
+	if submittedAt == nil {
+		return s.now
+	}
+	if skew := s.now.Sub(*submittedAt).Abs(); skew > s.maxSkew {
+		return s.now
+	}
+	return *submittedAt
+}
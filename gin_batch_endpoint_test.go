@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const testBatchItem = `{"op":"create","uuid":"0b7c5d2e-3f4a-4b6c-8d9e-0f1a2b3c4d5e","satisfied":true,"metadata":{}}`
+
+var batchRouteTests = []struct {
+	name        string
+	path        string
+	body        string
+	wantCode    int
+	wantProblem string
+}{
+	{"too many items", "/submit/reports:batch", `{"items":[` + testBatchItem + `,` + testBatchItem + `]}`, http.StatusBadRequest, codeValidationFailed},
+	{"no items", "/submit/reports:batch", `{"items":[]}`, http.StatusBadRequest, codeValidationFailed},
+	{"unknown mode", "/submit/reports:batch", `{"mode":"all","items":[` + testBatchItem + `]}`, http.StatusBadRequest, codeValidationFailed},
+	{"malformed JSON", "/submit/reports:batch", `{"items":`, http.StatusBadRequest, codeInvalidBody},
+	{"other action", "/submit/reports:delete", `{"items":[]}`, http.StatusNotFound, codeNotFound},
+	{"no action", "/submit/reports", `{"items":[]}`, http.StatusNotFound, codeNotFound},
+}
+
+// TestBatchReportsRoute covers requests rejected before the database is used
+func TestBatchReportsRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useJSONFieldNames()
+
+	r := gin.New()
+	r.NoRoute(notFoundProblem)
+	r.POST("/submit/reports\\:batch", func(c *gin.Context) {
+		c.Set("db", (*gorm.DB)(nil))
+	}, batchReportsEndpoint(1, time.Hour))
+
+	for _, tt := range batchRouteTests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			var p dto.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("response isn't a problem: %v", err)
+			}
+			if p.Code != tt.wantProblem {
+				t.Errorf("got code %q, want %q", p.Code, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestBatchStateApply(t *testing.T) {
+	useJSONFieldNames()
+
+	existingUUID := uuid.New()
+	satisfied := false
+	unknownIssue := 42
+	metadata := datatypes.JSON(`{}`)
+
+	state := &batchState{
+		knownIssues: map[int]bool{1: true},
+		existing:    map[uuid.UUID]models.Report{existingUUID: {UUID: existingUUID}},
+		now:         time.Now(),
+		maxSkew:     time.Hour,
+	}
+
+	tests := []struct {
+		name string
+		item dto.BatchReportItem
+		want string
+	}{
+		{"missing satisfied", dto.BatchReportItem{Operation: dto.BatchOperationCreate, ReportRequest: dto.ReportRequest{UUID: uuid.New(), Metadata: &metadata}}, dto.BatchStatusInvalid},
+		{"unknown operation", dto.BatchReportItem{Operation: "delete", ReportRequest: dto.ReportRequest{UUID: uuid.New(), Satisfied: &satisfied, Metadata: &metadata}}, dto.BatchStatusInvalid},
+		{"unknown issue", dto.BatchReportItem{Operation: dto.BatchOperationCreate, ReportRequest: dto.ReportRequest{UUID: uuid.New(), Satisfied: &satisfied, IssueID: &unknownIssue, Metadata: &metadata}}, dto.BatchStatusInvalid},
+		{"create existing", dto.BatchReportItem{Operation: dto.BatchOperationCreate, ReportRequest: dto.ReportRequest{UUID: existingUUID, Satisfied: &satisfied, Metadata: &metadata}}, dto.BatchStatusConflict},
+		{"update missing", dto.BatchReportItem{Operation: dto.BatchOperationUpdate, ReportRequest: dto.ReportRequest{UUID: uuid.New(), Satisfied: &satisfied, Metadata: &metadata}}, dto.BatchStatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := state.apply(nil, tt.item)
+			if result.Status != tt.want {
+				t.Errorf("got status %q, want %q (errors: %v)", result.Status, tt.want, result.Errors)
+			}
+			if result.UUID != tt.item.UUID {
+				t.Errorf("got UUID %s, want %s", result.UUID, tt.item.UUID)
+			}
+		})
+	}
+}
+
+func TestBatchStateTimestamp(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	state := &batchState{now: now, maxSkew: time.Hour}
+	within := now.Add(-59 * time.Minute)
+	ahead := now.Add(61 * time.Minute)
+	behind := now.Add(-2 * time.Hour)
+
+	tests := []struct {
+		name        string
+		submittedAt *time.Time
+		want        time.Time
+	}{
+		{"not provided", nil, now},
+		{"within skew", &within, within},
+		{"too far ahead", &ahead, now},
+		{"too far behind", &behind, now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := state.timestamp(tt.submittedAt); !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 
 	"github.com/Stogas/feedback-api/internal/dto"
 	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/stream"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func ping(c *gin.Context) {
@@ -21,9 +26,10 @@ func GetIssuesEndpoint(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
 
 	var issues []models.Issue
-	if err := db.Find(&issues).Error; err != nil {
+	if err := db.Order("position, id").Find(&issues).Error; err != nil {
 		logger.Error("Failed to fetch issue types from DB")
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database read error"})
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseReadError, "Database read error")
+		return
 	}
 
 	c.JSON(http.StatusOK, dto.MapIssuesToIssueResponses(issues))
@@ -36,27 +42,69 @@ func submitReportEndpoint(c *gin.Context) {
 
 	db := c.MustGet("db").(*gorm.DB)
 
-	var existingReport models.Report
-	existingRow := db.Where("uuid = ?", newReport.UUID).First(&existingReport)
-	if existingRow.Error == nil {
+	// rely on the unique UUID index instead of checking for an existing report first,
+	// so that concurrent submissions of the same UUID can't both succeed
+	result := db.Create(&newReport)
+
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
 		logger.Warn("A submission with this UUID already exists", "uuid", newReport.UUID, "method", c.Request.Method)
-		c.JSON(http.StatusConflict, gin.H{"error": "A submission with this UUID already exists", "uuid": newReport.UUID, "created_at": existingReport.CreatedAt})
+		p := newProblem(c, http.StatusConflict, codeReportExists, "A submission with this UUID already exists")
+		p.Extensions = map[string]any{"uuid": newReport.UUID}
+		var existingReport models.Report
+		if err := db.Where("uuid = ?", newReport.UUID).First(&existingReport).Error; err == nil {
+			p.Extensions["created_at"] = existingReport.CreatedAt
+		}
+		abortWithProblemDetails(c, p)
 		return
-	} else if existingRow.Error != gorm.ErrRecordNotFound {
-		logger.Error("Error reading database", "error", existingRow.Error, "uuid", newReport.UUID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database read error"})
+	} else if result.Error != nil {
+		logger.Error("Database write error", "error", result.Error)
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseWriteError, "Database write error")
 		return
 	}
 
-	result := db.Create(&newReport)
+	publishReportEvent(c, stream.EventReportCreated, newReport)
+	setReportETag(c, newReport.Version)
+	c.JSON(http.StatusCreated, dto.MapReportToReportResponse(newReport))
+}
+
+// upsertReportEndpoint creates the report, or replaces it if it already exists
+func upsertReportEndpoint(c *gin.Context) {
+	newReport := c.MustGet("report").(models.Report)
+
+	logger := getLogger(c.Request.Context())
 
-	if result.Error != nil {
+	db := c.MustGet("db").(*gorm.DB)
+
+	// insert first and fall back to an update on a unique index violation, which is race-safe
+	result := db.Create(&newReport)
+	if result.Error == nil {
+		publishReportEvent(c, stream.EventReportCreated, newReport)
+		setReportETag(c, newReport.Version)
+		c.JSON(http.StatusCreated, dto.MapReportToReportResponse(newReport))
+		return
+	} else if !errors.Is(result.Error, gorm.ErrDuplicatedKey) {
 		logger.Error("Database write error", "error", result.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database write error"})
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseWriteError, "Database write error")
 		return
 	}
 
-	c.JSON(http.StatusCreated, dto.MapReportToReportResponse(newReport))
+	updatedReport, updated, err := saveReportUpdate(db, newReport, nil)
+	if err != nil {
+		logger.Error("Database write error", "error", err)
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseWriteError, "Database write error")
+		return
+	} else if !updated {
+		// the UUID belongs to a deleted report
+		logger.Warn("A PUT submission tried to replace a deleted report", "uuid", newReport.UUID)
+		p := newProblem(c, http.StatusConflict, codeReportExists, "A submission with this UUID already exists")
+		p.Extensions = map[string]any{"uuid": newReport.UUID}
+		abortWithProblemDetails(c, p)
+		return
+	}
+
+	publishReportEvent(c, stream.EventReportUpdated, updatedReport)
+	setReportETag(c, updatedReport.Version)
+	c.JSON(http.StatusOK, dto.MapReportToReportResponse(updatedReport))
 }
 
 func updateReportEndpoint(c *gin.Context) {
@@ -66,29 +114,114 @@ func updateReportEndpoint(c *gin.Context) {
 
 	db := c.MustGet("db").(*gorm.DB)
 
+	versions, err := ifMatchVersions(c)
+	if err != nil {
+		abortWithMalformedETag(c, "If-Match")
+		return
+	}
+
 	var existingReport models.Report
 	existingRow := db.Where("uuid = ?", newReport.UUID).First(&existingReport)
 	if existingRow.Error == gorm.ErrRecordNotFound {
 		logger.Warn("A PATCH submission tried to modify a non-existing resource", "uuid", newReport.UUID, "method", c.Request.Method)
-		c.JSON(http.StatusNotFound, gin.H{"error": "A submission with this UUID has not been found, submit via HTTP POST instead", "uuid": newReport.UUID})
+		p := newProblem(c, http.StatusNotFound, codeReportNotFound, "A submission with this UUID has not been found, submit via HTTP POST instead")
+		p.Extensions = map[string]any{"uuid": newReport.UUID}
+		abortWithProblemDetails(c, p)
 		return
 	} else if existingRow.Error != nil {
 		logger.Error("Error reading database", "error", existingRow.Error, "uuid", newReport.UUID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database read error"})
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseReadError, "Database read error")
+		return
+	}
+
+	if versions != nil && !slices.Contains(versions, existingReport.Version) {
+		abortWithVersionMismatch(c, existingReport)
 		return
 	}
 
-	newReport.ID = existingReport.ID
-	newReport.CreatedAt = existingReport.CreatedAt
-	newReport.DeletedAt = existingReport.DeletedAt
+	updatedReport, updated, err := saveReportUpdate(db, newReport, versions)
+	if err != nil {
+		logger.Error("Database write error", "error", err)
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseWriteError, "Database write error")
+		return
+	} else if !updated {
+		// modified concurrently since it was read
+		logger.Warn("A PATCH submission lost a concurrent update race", "uuid", newReport.UUID)
+		abortWithVersionMismatch(c, existingReport)
+		return
+	}
 
-	result := db.Save(&newReport)
+	publishReportEvent(c, stream.EventReportUpdated, updatedReport)
+	setReportETag(c, updatedReport.Version)
+	c.JSON(http.StatusOK, dto.MapReportToReportResponse(updatedReport))
+}
 
-	if result.Error != nil {
-		logger.Error("Database write error", "error", result.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database write error"})
+func getReportEndpoint(c *gin.Context) {
+	logger := getLogger(c.Request.Context())
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	reportUUID, err := uuid.Parse(c.Param("uuid"))
+	if err != nil {
+		p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "One or more fields are invalid")
+		p.Errors = []dto.FieldError{{Field: "uuid", Code: "uuid", Message: "must be a valid UUID"}}
+		abortWithProblemDetails(c, p)
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.MapReportToReportResponse(newReport))
+	var report models.Report
+	if err := db.Where("uuid = ?", reportUUID).First(&report).Error; err == gorm.ErrRecordNotFound {
+		p := newProblem(c, http.StatusNotFound, codeReportNotFound, "A submission with this UUID has not been found")
+		p.Extensions = map[string]any{"uuid": reportUUID}
+		abortWithProblemDetails(c, p)
+		return
+	} else if err != nil {
+		logger.Error("Error reading database", "error", err, "uuid", reportUUID)
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseReadError, "Database read error")
+		return
+	}
+
+	setReportETag(c, report.Version)
+	versions, err := ifNoneMatchVersions(c)
+	if err == nil && (c.GetHeader("If-None-Match") == "*" || slices.Contains(versions, report.Version)) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapReportToReportResponse(report))
+}
+
+func abortWithVersionMismatch(c *gin.Context, current models.Report) {
+	setReportETag(c, current.Version)
+	p := newProblem(c, http.StatusPreconditionFailed, codePreconditionFailed, "The report has been modified since it was last read, fetch it and retry")
+	p.Extensions = map[string]any{"uuid": current.UUID}
+	abortWithProblemDetails(c, p)
+}
+
+// saveReportUpdate replaces the submitted fields of an existing report and increments its version.
+// If versions is not nil, the report is only updated while its version is one of them.
+// It returns the stored report and whether it was updated.
+func saveReportUpdate(db *gorm.DB, newReport models.Report, versions []int) (models.Report, bool, error) {
+	fields := map[string]any{
+		"satisfied": newReport.Satisfied,
+		"issue_id":  newReport.IssueID,
+		"comment":   newReport.Comment,
+		"metadata":  nil,
+		"version":   gorm.Expr("version + 1"),
+	}
+	if newReport.Metadata != nil {
+		fields["metadata"] = *newReport.Metadata
+	}
+	// keep client-provided update times (batch submissions), otherwise GORM sets the current time
+	if !newReport.UpdatedAt.IsZero() {
+		fields["updated_at"] = newReport.UpdatedAt
+	}
+
+	var stored models.Report
+	q := db.Model(&stored).Clauses(clause.Returning{}).Where("uuid = ?", newReport.UUID)
+	if versions != nil {
+		q = q.Where("version IN ?", versions)
+	}
+	result := q.Updates(fields)
+	return stored, result.RowsAffected > 0, result.Error
 }
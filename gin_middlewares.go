@@ -2,21 +2,35 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Depado/ginprom"
+	"github.com/Stogas/feedback-api/internal/apikeys"
+	"github.com/Stogas/feedback-api/internal/config"
 	"github.com/Stogas/feedback-api/internal/dto"
 	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/signing"
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
-func createDBMiddleware(db *gorm.DB) gin.HandlerFunc {
+// createDBMiddleware rejects requests until the database is ready, as they'd fail or see a partially migrated schema
+func createDBMiddleware(db *gorm.DB, ready *readiness) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !ready.started() {
+			c.Header("Retry-After", "5")
+			abortWithProblem(c, http.StatusServiceUnavailable, codeNotReady, "The service is starting, try again later")
+			return
+		}
 		ctx := c.Request.Context()
 		c.Set("db", db.WithContext(ctx))
 		c.Next()
@@ -31,14 +45,107 @@ func metricsMiddleware(p *ginprom.Prometheus) gin.HandlerFunc {
 	}
 }
 
-func submitTokenMiddleware(token string) gin.HandlerFunc {
+// submitTokenMiddleware accepts requests signed by one of the signing clients, or with any of the tokens which hasn't expired.
+// Any request is accepted if there are neither tokens nor signing clients.
+func submitTokenMiddleware(live *liveConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if token == "" || c.GetHeader("X-Feedback-Submit-Token") == token {
+		auth := live.submitAuth.Load()
+		tokens, clients := auth.tokens, auth.clients
+		if len(clients) > 0 && c.GetHeader(signing.HeaderSignature) != "" {
+			verifySignedSubmission(c, clients, auth.signatureWindow)
+			return
+		}
+		if len(tokens) == 0 && len(clients) == 0 {
 			c.Next()
-		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "X-Feedback-Submit-Token not provided or incorrect"})
 			return
 		}
+
+		header := c.GetHeader("X-Feedback-Submit-Token")
+		i := slices.IndexFunc(tokens, func(token config.SubmitToken) bool {
+			return subtle.ConstantTimeCompare([]byte(header), []byte(token.Token)) == 1
+		})
+		if i == -1 {
+			countSubmitTokenRequest(c, "", "invalid")
+			abortWithProblem(c, http.StatusUnauthorized, codeUnauthorized, "X-Feedback-Submit-Token not provided or incorrect")
+			return
+		}
+
+		token := tokens[i]
+		if !token.ExpiresAt.IsZero() && time.Now().After(token.ExpiresAt) {
+			getLogger(c.Request.Context()).Warn("Submission with an expired submit token", "token", token.Label, "expiredAt", token.ExpiresAt)
+			countSubmitTokenRequest(c, token.Label, "expired")
+			abortWithProblem(c, http.StatusUnauthorized, codeUnauthorized, "X-Feedback-Submit-Token has expired")
+			return
+		}
+
+		countSubmitTokenRequest(c, token.Label, "accepted")
+		c.Set("submitToken", token.Label)
+		c.Next()
+	}
+}
+
+// countSubmitTokenRequest increments the metric of submission requests by token label and whether the token was accepted
+func countSubmitTokenRequest(c *gin.Context, label string, result string) {
+	p := c.MustGet("prom").(*ginprom.Prometheus)
+	err := p.IncrementCounterValue("submit_token_requests_total", []string{label, result})
+	if err != nil {
+		getLogger(c.Request.Context()).Error("Failed to increment metrics counter")
+	}
+}
+
+// apiKeyMiddleware authenticates requests with an API key in the Authorization header, of any role
+func apiKeyMiddleware(c *gin.Context) {
+	logger := getLogger(c.Request.Context())
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || key == "" {
+		abortWithProblem(c, http.StatusUnauthorized, codeUnauthorized, "API key not provided, expected an 'Authorization: Bearer <key>' header")
+		return
+	}
+
+	apiKey, err := apikeys.Authenticate(db, key)
+	if errors.Is(err, apikeys.ErrInvalidKey) {
+		logger.Warn("Request with an unknown, revoked or expired API key")
+		abortWithProblem(c, http.StatusUnauthorized, codeUnauthorized, "API key is unknown, revoked or expired")
+		return
+	} else if err != nil {
+		logger.Error("Failed to fetch API key from DB", "error", err)
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseReadError, "Database read error")
+		return
+	}
+	if err := apikeys.Touch(db, &apiKey); err != nil {
+		logger.Warn("Failed to record API key use", "error", err, "apiKey", apiKey.Name)
+	}
+
+	c.Set("apiKey", apiKey)
+	c.Set("role", apiKey.Role)
+	c.Next()
+}
+
+// roleMiddleware rejects authenticated requests whose role doesn't allow at least role
+func roleMiddleware(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if have := c.GetString("role"); !apikeys.Allows(have, role) {
+			abortWithProblem(c, http.StatusForbidden, codeForbidden, fmt.Sprintf("Role '%s' is not allowed to do this, '%s' is required", have, role))
+			return
+		}
+		c.Next()
+	}
+}
+
+// deprecationMiddleware marks responses of deprecated routes (RFC 9745 & RFC 8594),
+// pointing clients to the same route under successorPrefix
+func deprecationMiddleware(successorPrefix string, deprecatedAt time.Time, sunset time.Time) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", deprecatedAt.Unix())
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Header("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successorPrefix, c.Request.URL.Path))
+		c.Next()
 	}
 }
 
@@ -48,13 +155,23 @@ func reportMiddleware(c *gin.Context) {
 
 	if err := c.ShouldBindJSON(&r); err != nil {
 		// If there's an error in parsing JSON, return an error response
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithBindingError(c, err)
+		return
+	}
+
+	// routes addressing a report by UUID require the same UUID in the body
+	if pathUUID := c.Param("uuid"); pathUUID != "" && pathUUID != r.UUID.String() {
+		p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "One or more fields are invalid")
+		p.Errors = []dto.FieldError{{Field: "uuid", Code: "path", Message: "must match the UUID in the path"}}
+		abortWithProblemDetails(c, p)
 		return
 	}
 
 	// special handling for booleans, as it's necessary to detect if it was not provided (default value for booleans is False)
 	if r.Satisfied == nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Field 'satisfied' not provided"})
+		p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "One or more fields are invalid")
+		p.Errors = []dto.FieldError{{Field: "satisfied", Code: "required", Message: "is required"}}
+		abortWithProblemDetails(c, p)
 		return
 	}
 
@@ -64,38 +181,55 @@ func reportMiddleware(c *gin.Context) {
 		db := c.MustGet("db").(*gorm.DB)
 		if err := db.First(&knownIssue, r.IssueID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+				p := newProblem(c, http.StatusBadRequest, codeInvalidIssueID, "Invalid issue ID")
+				p.Errors = []dto.FieldError{{Field: "issue_id", Code: "exists", Message: "must refer to a known issue type"}}
+				abortWithProblemDetails(c, p)
 				return
 			}
 			logger.Error("Error reading database", "error", err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database read error"})
+			abortWithProblem(c, http.StatusInternalServerError, codeDatabaseReadError, "Database read error")
 			return
 		}
 	}
 
 	c.Set("report", models.Report{
-		UUID:      r.UUID,
-		Satisfied: r.Satisfied,
-		IssueID:   r.IssueID,
-		Comment:   r.Comment,
-		Metadata:  r.Metadata,
+		UUID:       r.UUID,
+		Satisfied:  r.Satisfied,
+		IssueID:    r.IssueID,
+		Comment:    r.Comment,
+		Metadata:   r.Metadata,
+		TokenLabel: c.GetString("submitToken"),
 	})
 
 	c.Next()
 
-	if c.Request.Method == "POST" {
-		statusCode := c.Writer.Status()
-		if statusCode >= 200 && statusCode < 300 {
-			logger.Debug("Response will be a success, will increment metrics")
-			p := c.MustGet("prom").(*ginprom.Prometheus)
-			err := p.IncrementCounterValue("reports_total", []string{strconv.FormatBool(*r.Satisfied)})
-			if err != nil {
-				logger.Error("Failed to increment metrics counter")
-			}
-		} else {
-			logger.Debug("Response will not be a success, skipping metrics increment")
-		}
+	// only new reports are counted
+	if c.Writer.Status() == http.StatusCreated {
+		logger.Debug("Response will be a success, will increment metrics")
+		countReport(c, *r.Satisfied)
+	} else {
+		logger.Debug("Response will not be a new report, skipping metrics increment")
+	}
+}
+
+// countReport increments the metric of successfully received new reports
+func countReport(c *gin.Context, satisfied bool) {
+	p := c.MustGet("prom").(*ginprom.Prometheus)
+	err := p.IncrementCounterValue("reports_total", []string{strconv.FormatBool(satisfied)})
+	if err != nil {
+		getLogger(c.Request.Context()).Error("Failed to increment metrics counter")
+	}
+}
+
+// logMiddleware returns the request logger of the log format, which includes trace IDs when tracing
+func logMiddleware(conf config.LogsConfig, tracing bool) gin.HandlerFunc {
+	if !conf.JSON {
+		return gin.Logger()
+	}
+	if tracing {
+		return traceLogMiddleware()
 	}
+	return regularLogMiddleware()
 }
 
 func regularLogMiddleware() gin.HandlerFunc {
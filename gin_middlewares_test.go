@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Depado/ginprom"
+	"github.com/Stogas/feedback-api/internal/apikeys"
+	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDeprecationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	deprecatedAt := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		sunset     time.Time
+		wantSunset string
+	}{
+		{
+			name:       "no sunset",
+			sunset:     time.Time{},
+			wantSunset: "",
+		},
+		{
+			name:       "sunset",
+			sunset:     time.Date(2027, time.April, 1, 12, 0, 0, 0, time.FixedZone("EEST", 3*60*60)),
+			wantSunset: "Thu, 01 Apr 2027 09:00:00 GMT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/issues", deprecationMiddleware("/v1", deprecatedAt, tt.sunset), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/issues", nil))
+
+			if got := w.Header().Get("Deprecation"); got != "@1792368000" {
+				t.Errorf("got Deprecation %q", got)
+			}
+			if got := w.Header().Get("Sunset"); got != tt.wantSunset {
+				t.Errorf("got Sunset %q, want %q", got, tt.wantSunset)
+			}
+			if got, want := w.Header().Get("Link"), `</v1/issues>; rel="successor-version"`; got != want {
+				t.Errorf("got Link %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRoleMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		role       string
+		wantStatus int
+	}{
+		{name: "allowed role", role: apikeys.RoleAdmin, wantStatus: http.StatusOK},
+		{name: "required role", role: apikeys.RoleExporter, wantStatus: http.StatusOK},
+		{name: "lower role", role: apikeys.RoleReader, wantStatus: http.StatusForbidden},
+		{name: "no role", role: "", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/admin/reports", func(c *gin.Context) { c.Set("role", tt.role) }, roleMiddleware(apikeys.RoleExporter), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/reports", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSubmitTokenMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := ginprom.New(ginprom.Registry(prometheus.NewRegistry()))
+	p.AddCustomCounter("submit_token_requests_total", "", []string{"token", "result"})
+	tokens := []config.SubmitToken{
+		{Label: "2026-10", Token: "old", ExpiresAt: time.Now().Add(-time.Minute)},
+		{Label: "2026-11", Token: "new", ExpiresAt: time.Now().Add(time.Hour)},
+		{Label: "default", Token: "static"},
+	}
+
+	tests := []struct {
+		name       string
+		tokens     []config.SubmitToken
+		header     string
+		wantStatus int
+		wantLabel  string
+	}{
+		{name: "no tokens configured", tokens: nil, header: "", wantStatus: http.StatusOK, wantLabel: ""},
+		{name: "valid token", tokens: tokens, header: "new", wantStatus: http.StatusOK, wantLabel: "2026-11"},
+		{name: "token without expiry", tokens: tokens, header: "static", wantStatus: http.StatusOK, wantLabel: "default"},
+		{name: "expired token", tokens: tokens, header: "old", wantStatus: http.StatusUnauthorized},
+		{name: "unknown token", tokens: tokens, header: "other", wantStatus: http.StatusUnauthorized},
+		{name: "no token", tokens: tokens, header: "", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := &liveConfig{}
+			live.submitAuth.Store(&submitAuth{tokens: tt.tokens, signatureWindow: time.Minute})
+			r := gin.New()
+			r.POST("/submit", func(c *gin.Context) { c.Set("prom", p) }, submitTokenMiddleware(live), func(c *gin.Context) {
+				if got := c.GetString("submitToken"); got != tt.wantLabel {
+					t.Errorf("got token label %q, want %q", got, tt.wantLabel)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/submit", nil)
+			req.Header.Set("X-Feedback-Submit-Token", tt.header)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
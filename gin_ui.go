@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/apikeys"
+	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/Stogas/feedback-api/internal/issues"
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/reports"
+	"github.com/Stogas/feedback-api/internal/sso"
+	"github.com/Stogas/feedback-api/internal/ui"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	uiReportsLimit = 50
+	// time series cover this long by default
+	uiDefaultPeriod = 30 * 24 * time.Hour
+)
+
+// addUIRoutes registers the admin web UI under /ui, which uses a session cookie instead of the API key header
+func addUIRoutes(e *gin.Engine, conf config.APIConfig, live *liveConfig, dbMiddleware gin.HandlerFunc, ssoProvider *sso.Provider) {
+	templates, err := ui.Templates()
+	if err != nil {
+		slog.Error("Failed to parse admin UI templates", "error", err)
+		panic("failed to parse admin UI templates")
+	}
+	e.SetHTMLTemplate(templates)
+
+	auth := &uiAuth{
+		sessionTTL:    conf.AdminUISessionTTL,
+		sessionSecret: &live.uiSessionSecret,
+		keyLogin:      conf.AdminUIKeyLogin,
+		sso:           ssoProvider,
+	}
+
+	r := e.Group("/ui")
+	r.Use(uiHeadersMiddleware)
+	r.GET("/login", auth.loginPage)
+	r.POST("/login", dbMiddleware, auth.apiKeyLogin)
+	if ssoProvider != nil {
+		r.GET("/oidc/login", auth.oidcLogin)
+		r.GET("/oidc/callback", auth.oidcCallback)
+	}
+
+	rAuth := r.Group("")
+	rAuth.Use(
+		dbMiddleware,
+		auth.sessionMiddleware,
+	)
+	{
+		rAuth.POST("/logout", uiLogout)
+		rAuth.GET("/", uiReportsPage)
+		rAuth.GET("/issues", uiIssuesPage(conf.IssueTypesMode))
+		rAuth.POST("/issues", uiIssueAction(conf.IssueTypesMode, uiCreateIssue))
+		rAuth.POST("/issues/:id", uiIssueAction(conf.IssueTypesMode, uiUpdateIssue))
+		rAuth.POST("/issues/:id/disable", uiIssueAction(conf.IssueTypesMode, uiDisableIssue))
+		rAuth.POST("/issues/:id/restore", uiIssueAction(conf.IssueTypesMode, uiRestoreIssue))
+	}
+}
+
+func uiHeadersMiddleware(c *gin.Context) {
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'self'; style-src 'self' 'unsafe-inline'")
+	c.Header("Cache-Control", "no-store")
+	c.Next()
+}
+
+func uiReportsPage(c *gin.Context) {
+	logger := getLogger(c.Request.Context())
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	query := c.Request.URL.Query()
+	page := uiPage(c, "Reports")
+	page["Query"] = query
+	page["Intervals"] = reports.Intervals
+
+	var issueTypes []models.Issue
+	if err := db.Order("position, id").Find(&issueTypes).Error; err != nil {
+		logger.Error("Failed to fetch issue types from DB", "error", err)
+		page["Error"] = "Database read error"
+		c.HTML(http.StatusInternalServerError, "reports.html", page)
+		return
+	}
+	page["Issues"] = issueTypes
+
+	filter, err := reports.ParseFilter(query)
+	if err != nil {
+		page["Error"] = err.Error()
+		c.HTML(http.StatusBadRequest, "reports.html", page)
+		return
+	}
+	// the chart would be unreadable over all time
+	if filter.From == nil {
+		from := time.Now().Add(-uiDefaultPeriod)
+		filter.From = &from
+	}
+
+	interval := c.DefaultQuery("interval", "day")
+	page["Interval"] = interval
+	if !slices.Contains(reports.Intervals, interval) {
+		page["Error"] = fmt.Sprintf("Invalid interval %q, expected one of %s", interval, strings.Join(reports.Intervals, ", "))
+		c.HTML(http.StatusBadRequest, "reports.html", page)
+		return
+	}
+	if !uiReportsChart(c, db, filter, interval, page) {
+		return
+	}
+
+	// readers only see aggregated data
+	if !apikeys.Allows(c.GetString("role"), apikeys.RoleExporter) {
+		c.HTML(http.StatusOK, "reports.html", page)
+		return
+	}
+	page["CanReadReports"] = true
+	if !uiReportsList(c, db, filter, query, page) {
+		return
+	}
+
+	c.HTML(http.StatusOK, "reports.html", page)
+}
+
+// uiReportsChart adds the chart and totals of the filtered reports to page,
+// returning false if it failed and the error was rendered instead
+func uiReportsChart(c *gin.Context, db *gorm.DB, filter reports.Filter, interval string, page gin.H) bool {
+	buckets, err := reports.GetTimeSeries(db, filter, interval)
+	if err != nil {
+		getLogger(c.Request.Context()).Error("Failed to aggregate report time series", "error", err)
+		page["Error"] = "Failed to aggregate reports"
+		c.HTML(http.StatusInternalServerError, "reports.html", page)
+		return false
+	}
+	page["Chart"] = ui.NewChart(buckets)
+
+	var total reports.Stats
+	for _, b := range buckets {
+		total.Total += b.Total
+		total.Satisfied += b.Satisfied
+	}
+	page["Stats"] = total
+	return true
+}
+
+// uiReportsList adds a page of the filtered reports to page, along with links to the previous and next pages,
+// returning false if it failed and the error was rendered instead
+func uiReportsList(c *gin.Context, db *gorm.DB, filter reports.Filter, query url.Values, page gin.H) bool {
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	offset = max(offset, 0)
+	var found []models.Report
+	err := filter.Apply(db).
+		Preload("Issue", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Order("created_at DESC").
+		Limit(uiReportsLimit + 1).
+		Offset(offset).
+		Find(&found).Error
+	if err != nil {
+		getLogger(c.Request.Context()).Error("Failed to fetch reports from DB", "error", err)
+		page["Error"] = "Database read error"
+		c.HTML(http.StatusInternalServerError, "reports.html", page)
+		return false
+	}
+
+	// one more report than shown is fetched to know whether there's a next page
+	if len(found) > uiReportsLimit {
+		found = found[:uiReportsLimit]
+		page["NextPage"] = uiPageURL(query, offset+uiReportsLimit)
+	}
+	if offset > 0 {
+		page["PrevPage"] = uiPageURL(query, max(offset-uiReportsLimit, 0))
+	}
+	page["Reports"] = found
+	return true
+}
+
+func uiPageURL(query url.Values, offset int) string {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("offset", strconv.Itoa(offset))
+	return "/ui/?" + q.Encode()
+}
+
+type uiIssue struct {
+	models.Issue
+	Reports int64
+}
+
+func uiIssuesPage(mode string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderUIIssues(c, mode, http.StatusOK, "")
+	}
+}
+
+// uiIssueAction applies a change to issue types submitted by a form, redirecting back to the issue types
+func uiIssueAction(mode string, change func(c *gin.Context, db *gorm.DB, id uint) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if mode != issues.ModeAPI {
+			renderUIIssues(c, mode, http.StatusConflict, "Issue types are managed with ISSUE_TYPES")
+			return
+		}
+		if !apikeys.Allows(c.GetString("role"), apikeys.RoleAdmin) {
+			renderUIIssues(c, mode, http.StatusForbidden, "Changing issue types requires the admin role")
+			return
+		}
+
+		db := c.MustGet("db").(*gorm.DB)
+
+		var id uint
+		if c.Param("id") != "" {
+			parsed, err := strconv.ParseUint(c.Param("id"), 10, 0)
+			if err != nil {
+				renderUIIssues(c, mode, http.StatusBadRequest, "Invalid issue type ID")
+				return
+			}
+			id = uint(parsed)
+		}
+
+		if err := change(c, db, id); err != nil {
+			status := http.StatusBadRequest
+			switch {
+			case errors.Is(err, issues.ErrNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, issues.ErrNameExists):
+				status = http.StatusConflict
+			case errors.Is(err, issues.ErrEmptyName), errors.Is(err, errInvalidPosition):
+			default:
+				getLogger(c.Request.Context()).Error("Database write error", "error", err)
+				status = http.StatusInternalServerError
+				err = errors.New("database write error")
+			}
+			renderUIIssues(c, mode, status, err.Error())
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, "/ui/issues")
+	}
+}
+
+var errInvalidPosition = errors.New("position must be a number")
+
+func uiFormPosition(c *gin.Context) (int, error) {
+	position, err := strconv.Atoi(c.DefaultPostForm("position", "0"))
+	if err != nil {
+		return 0, errInvalidPosition
+	}
+	return position, nil
+}
+
+func uiCreateIssue(c *gin.Context, db *gorm.DB, _ uint) error {
+	position, err := uiFormPosition(c)
+	if err != nil {
+		return err
+	}
+	_, err = issues.Create(db, c.PostForm("name"), position)
+	return err
+}
+
+func uiUpdateIssue(c *gin.Context, db *gorm.DB, id uint) error {
+	position, err := uiFormPosition(c)
+	if err != nil {
+		return err
+	}
+	name := c.PostForm("name")
+	_, err = issues.Update(db, id, &name, &position)
+	return err
+}
+
+func uiDisableIssue(_ *gin.Context, db *gorm.DB, id uint) error {
+	_, err := issues.Disable(db, id)
+	return err
+}
+
+func uiRestoreIssue(_ *gin.Context, db *gorm.DB, id uint) error {
+	_, err := issues.Restore(db, id)
+	return err
+}
+
+func renderUIIssues(c *gin.Context, mode string, status int, message string) {
+	logger := getLogger(c.Request.Context())
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	page := uiPage(c, "Issue types")
+	page["Managed"] = mode == issues.ModeAPI
+	page["Editable"] = mode == issues.ModeAPI && apikeys.Allows(c.GetString("role"), apikeys.RoleAdmin)
+	page["Error"] = message
+
+	all, err := issues.List(db)
+	if err != nil {
+		logger.Error("Failed to fetch issue types from DB", "error", err)
+		page["Error"] = "Database read error"
+		c.HTML(http.StatusInternalServerError, "issues.html", page)
+		return
+	}
+	stats, err := reports.GetStats(db, reports.Filter{}, "issue")
+	if err != nil {
+		logger.Error("Failed to aggregate report stats", "error", err)
+		page["Error"] = "Database read error"
+		c.HTML(http.StatusInternalServerError, "issues.html", page)
+		return
+	}
+
+	counts := make(map[string]int64, len(stats))
+	for _, s := range stats {
+		if s.Group != nil {
+			counts[*s.Group] = s.Total
+		}
+	}
+	rows := make([]uiIssue, len(all))
+	for i, issue := range all {
+		rows[i] = uiIssue{Issue: issue, Reports: counts[strconv.FormatUint(uint64(issue.ID), 10)]}
+	}
+	page["Issues"] = rows
+
+	c.HTML(status, "issues.html", page)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/apikeys"
+	"github.com/Stogas/feedback-api/internal/sso"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	uiSessionCookie = "feedback_admin_session"
+	// name of the hidden form field holding the CSRF token
+	uiCSRFField = "csrf_token"
+	// holds the state of a started OIDC login until the provider redirects back
+	uiOIDCLoginCookie = "feedback_oidc_login"
+	uiOIDCLoginTTL    = 10 * time.Minute
+)
+
+// uiAuth logs admin UI users in with API keys and/or OIDC
+type uiAuth struct {
+	sessionTTL time.Duration
+	// signs sessions (those of API keys with a secret derived for the key) and CSRF tokens,
+	// may be rotated by a config reload
+	sessionSecret *atomic.Pointer[[]byte]
+	keyLogin      bool
+	// nil if OIDC login is disabled
+	sso *sso.Provider
+}
+
+// uiSession is the signed content of the session cookie
+type uiSession struct {
+	// ID of the API key logged in with, 0 for OIDC logins
+	KeyID uint `json:"k,omitempty"`
+	// name and role of the OIDC user
+	User      string `json:"u,omitempty"`
+	Role      string `json:"r,omitempty"`
+	ExpiresAt int64  `json:"e"`
+}
+
+func (a *uiAuth) secret() []byte {
+	return *a.sessionSecret.Load()
+}
+
+func uiSessionSignature(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("feedback-admin-ui:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// keySessionSecret derives the secret signing the sessions of an API key from the server's secret,
+// rather than from anything stored in the database, so that reading the database isn't enough to forge a session
+func (a *uiAuth) keySessionSecret(keyID uint) []byte {
+	mac := hmac.New(sha256.New, a.secret())
+	mac.Write([]byte("api-key:" + strconv.FormatUint(uint64(keyID), 10)))
+	return mac.Sum(nil)
+}
+
+// csrfToken is bound to the session payload, so that it changes with every login and can't be reused by another session
+func (a *uiAuth) csrfToken(payload string) string {
+	mac := hmac.New(sha256.New, a.secret())
+	mac.Write([]byte("csrf:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// setSession sets the session cookie, formatted as "<base64 JSON session>.<signature>"
+func (a *uiAuth) setSession(c *gin.Context, session uiSession, secret []byte) {
+	expiresAt := time.Now().Add(a.sessionTTL)
+	// sessions can't outlive their key
+	if limit := time.Unix(session.ExpiresAt, 0); session.ExpiresAt != 0 && limit.Before(expiresAt) {
+		expiresAt = limit
+	}
+	session.ExpiresAt = expiresAt.Unix()
+
+	encoded, _ := json.Marshal(session)
+	payload := base64.RawURLEncoding.EncodeToString(encoded)
+	setUICookie(c, uiSessionCookie, payload+"."+uiSessionSignature(secret, payload), "/ui", int(time.Until(expiresAt).Seconds()))
+}
+
+// sessionMiddleware redirects to the login page unless the session cookie is signed and, for API key logins, the key is still usable.
+// State-changing requests must also carry the CSRF token of the session, which pages get from uiPage.
+func (a *uiAuth) sessionMiddleware(c *gin.Context) {
+	cookie, _ := c.Cookie(uiSessionCookie)
+	payload, signature, _ := strings.Cut(cookie, ".")
+	var session uiSession
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(decoded, &session) != nil || time.Now().Unix() > session.ExpiresAt {
+		uiRedirectToLogin(c)
+		return
+	}
+
+	if session.KeyID == 0 {
+		// OIDC sessions keep the role the user had when logging in
+		if a.sso == nil || !hmac.Equal([]byte(signature), []byte(uiSessionSignature(a.secret(), payload))) {
+			uiRedirectToLogin(c)
+			return
+		}
+		c.Set("user", session.User)
+		c.Set("role", session.Role)
+	} else if !a.authenticateKeySession(c, session.KeyID, payload, signature) {
+		return
+	}
+
+	csrfToken := a.csrfToken(payload)
+	if c.Request.Method != http.MethodGet && !hmac.Equal([]byte(c.PostForm(uiCSRFField)), []byte(csrfToken)) {
+		getLogger(c.Request.Context()).Warn("Admin UI request without a valid CSRF token", "user", c.GetString("user"))
+		c.String(http.StatusForbidden, "The form has expired, please reload the page and try again")
+		c.Abort()
+		return
+	}
+
+	c.Set("csrfToken", csrfToken)
+	c.Next()
+}
+
+// authenticateKeySession checks that the key of a session is still usable and signed the session,
+// aborting the request with a redirect to the login page if not
+func (a *uiAuth) authenticateKeySession(c *gin.Context, keyID uint, payload string, signature string) bool {
+	logger := getLogger(c.Request.Context())
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	if !a.keyLogin {
+		uiRedirectToLogin(c)
+		return false
+	}
+	apiKey, err := apikeys.Find(db, keyID)
+	if errors.Is(err, apikeys.ErrNotFound) {
+		uiRedirectToLogin(c)
+		return false
+	} else if err != nil {
+		logger.Error("Failed to fetch API key from DB", "error", err)
+		c.HTML(http.StatusInternalServerError, "login.html", a.loginPageData("Database read error"))
+		c.Abort()
+		return false
+	}
+	if !apikeys.Usable(apiKey) || !hmac.Equal([]byte(signature), []byte(uiSessionSignature(a.keySessionSecret(keyID), payload))) {
+		uiRedirectToLogin(c)
+		return false
+	}
+	if err := apikeys.Touch(db, &apiKey); err != nil {
+		logger.Warn("Failed to record API key use", "error", err, "apiKey", apiKey.Name)
+	}
+
+	c.Set("apiKey", apiKey)
+	c.Set("user", apiKey.Name)
+	c.Set("role", apiKey.Role)
+	return true
+}
+
+func uiRedirectToLogin(c *gin.Context) {
+	c.Redirect(http.StatusSeeOther, "/ui/login")
+	c.Abort()
+}
+
+func setUICookie(c *gin.Context, name string, value string, path string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	// Lax rather than Strict, so that cookies are sent when the OIDC provider redirects back.
+	// All changes are POST requests, which Lax cookies aren't sent with from other sites.
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, path, "", secure, true)
+}
+
+// uiPage returns the data shared by all pages behind the login, for the page template to add to
+func uiPage(c *gin.Context, title string) gin.H {
+	return gin.H{"Title": title, "CSRFToken": c.GetString("csrfToken")}
+}
+
+func (a *uiAuth) loginPageData(message string) gin.H {
+	return gin.H{"Error": message, "KeyLogin": a.keyLogin, "SSO": a.sso != nil}
+}
+
+func (a *uiAuth) loginPage(c *gin.Context) {
+	c.HTML(http.StatusOK, "login.html", a.loginPageData(""))
+}
+
+func (a *uiAuth) apiKeyLogin(c *gin.Context) {
+	logger := getLogger(c.Request.Context())
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	if !a.keyLogin {
+		c.HTML(http.StatusForbidden, "login.html", a.loginPageData("Logging in with API keys is disabled"))
+		return
+	}
+
+	apiKey, err := apikeys.Authenticate(db, c.PostForm("key"))
+	if errors.Is(err, apikeys.ErrInvalidKey) {
+		logger.Warn("Failed admin UI login")
+		c.HTML(http.StatusUnauthorized, "login.html", a.loginPageData("API key is unknown, revoked or expired"))
+		return
+	} else if err != nil {
+		logger.Error("Failed to fetch API key from DB", "error", err)
+		c.HTML(http.StatusInternalServerError, "login.html", a.loginPageData("Database read error"))
+		return
+	}
+	logger.Info("Admin UI login", "apiKey", apiKey.Name, "role", apiKey.Role)
+
+	session := uiSession{KeyID: apiKey.ID}
+	if apiKey.ExpiresAt != nil {
+		session.ExpiresAt = apiKey.ExpiresAt.Unix()
+	}
+	a.setSession(c, session, a.keySessionSecret(apiKey.ID))
+	c.Redirect(http.StatusSeeOther, "/ui/")
+}
+
+// oidcLogin redirects to the OIDC provider, which redirects back to oidcCallback
+func (a *uiAuth) oidcLogin(c *gin.Context) {
+	logger := getLogger(c.Request.Context())
+
+	url, login, err := a.sso.Start(c.Request.Context())
+	if err != nil {
+		logger.Error("Failed to start OIDC login", "error", err)
+		c.HTML(http.StatusBadGateway, "login.html", a.loginPageData("The identity provider is unavailable"))
+		return
+	}
+
+	encoded, _ := json.Marshal(login)
+	setUICookie(c, uiOIDCLoginCookie, base64.RawURLEncoding.EncodeToString(encoded), "/ui/oidc", int(uiOIDCLoginTTL.Seconds()))
+	c.Redirect(http.StatusFound, url)
+}
+
+func (a *uiAuth) oidcCallback(c *gin.Context) {
+	logger := getLogger(c.Request.Context())
+
+	cookie, _ := c.Cookie(uiOIDCLoginCookie)
+	setUICookie(c, uiOIDCLoginCookie, "", "/ui/oidc", -1)
+
+	var login sso.Login
+	decoded, err := base64.RawURLEncoding.DecodeString(cookie)
+	if err != nil || json.Unmarshal(decoded, &login) != nil || login.State == "" ||
+		subtle.ConstantTimeCompare([]byte(login.State), []byte(c.Query("state"))) != 1 {
+		c.HTML(http.StatusBadRequest, "login.html", a.loginPageData("The login has expired or was started in another browser, please try again"))
+		return
+	}
+	if providerError := c.Query("error"); providerError != "" {
+		logger.Warn("OIDC provider rejected login", "error", providerError, "description", c.Query("error_description"))
+		c.HTML(http.StatusUnauthorized, "login.html", a.loginPageData("The identity provider rejected the login: "+providerError))
+		return
+	}
+
+	user, err := a.sso.Finish(c.Request.Context(), login, c.Query("code"))
+	if errors.Is(err, sso.ErrNoRole) {
+		logger.Warn("OIDC login of a user without a mapped role", "user", user.Name)
+		c.HTML(http.StatusForbidden, "login.html", a.loginPageData("Your account isn't allowed to use the admin UI"))
+		return
+	} else if err != nil {
+		logger.Error("OIDC login failed", "error", err)
+		c.HTML(http.StatusBadGateway, "login.html", a.loginPageData("Login with the identity provider failed"))
+		return
+	}
+	logger.Info("Admin UI login", "user", user.Name, "role", user.Role)
+
+	a.setSession(c, uiSession{User: user.Name, Role: user.Role}, a.secret())
+	c.Redirect(http.StatusSeeOther, "/ui/")
+}
+
+func uiLogout(c *gin.Context) {
+	setUICookie(c, uiSessionCookie, "", "/ui", -1)
+	c.Redirect(http.StatusSeeOther, "/ui/login")
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/sso"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var testUIAuth = &uiAuth{sessionTTL: time.Hour, sessionSecret: testUISecret("test secret"), keyLogin: true, sso: &sso.Provider{}}
+
+func testUISecret(secret string) *atomic.Pointer[[]byte] {
+	var p atomic.Pointer[[]byte]
+	b := []byte(secret)
+	p.Store(&b)
+	return &p
+}
+
+// testUISession returns a session cookie value and its payload, signed like setSession would
+func testUISession(a *uiAuth, session uiSession) (string, string) {
+	encoded, _ := json.Marshal(session)
+	payload := base64.RawURLEncoding.EncodeToString(encoded)
+	secret := a.secret()
+	if session.KeyID != 0 {
+		secret = a.keySessionSecret(session.KeyID)
+	}
+	return payload + "." + uiSessionSignature(secret, payload), payload
+}
+
+func TestUISessionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// a dry run finds a usable key for any ID
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	future := time.Now().Add(time.Hour).Unix()
+	valid, payload := testUISession(testUIAuth, uiSession{KeyID: 3, ExpiresAt: future})
+	expired, _ := testUISession(testUIAuth, uiSession{KeyID: 3, ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	otherSecret, _ := testUISession(&uiAuth{sessionSecret: testUISecret("other secret")}, uiSession{KeyID: 3, ExpiresAt: future})
+	oidc, oidcPayload := testUISession(testUIAuth, uiSession{User: "jane", Role: "reader", ExpiresAt: future})
+
+	tests := []struct {
+		name       string
+		auth       *uiAuth
+		method     string
+		cookie     string
+		csrfToken  string
+		wantStatus int
+	}{
+		{"no session", testUIAuth, http.MethodGet, "", "", http.StatusSeeOther},
+		{"valid session", testUIAuth, http.MethodGet, valid, "", http.StatusOK},
+		{"expired session", testUIAuth, http.MethodGet, expired, "", http.StatusSeeOther},
+		{"signed with another secret", testUIAuth, http.MethodGet, otherSecret, "", http.StatusSeeOther},
+		{"tampered session", testUIAuth, http.MethodGet, "x" + valid, "", http.StatusSeeOther},
+		{"key login disabled", &uiAuth{sessionSecret: testUIAuth.sessionSecret}, http.MethodGet, valid, "", http.StatusSeeOther},
+		{"OIDC session", testUIAuth, http.MethodGet, oidc, "", http.StatusOK},
+		{"OIDC disabled", &uiAuth{sessionSecret: testUIAuth.sessionSecret, keyLogin: true}, http.MethodGet, oidc, "", http.StatusSeeOther},
+		{"post with CSRF token", testUIAuth, http.MethodPost, valid, testUIAuth.csrfToken(payload), http.StatusOK},
+		{"post without CSRF token", testUIAuth, http.MethodPost, valid, "", http.StatusForbidden},
+		{"post with CSRF token of another session", testUIAuth, http.MethodPost, valid, testUIAuth.csrfToken(oidcPayload), http.StatusForbidden},
+		{"OIDC post with CSRF token", testUIAuth, http.MethodPost, oidc, testUIAuth.csrfToken(oidcPayload), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveUISession(t, db, tt.auth, tt.method, tt.cookie, tt.csrfToken); got != tt.wantStatus {
+				t.Errorf("got status %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// serveUISession sends a request with the session cookie and CSRF token
+// through the session middleware and returns the response status.
+func serveUISession(t *testing.T, db *gorm.DB, a *uiAuth, method, cookie, csrfToken string) int {
+	t.Helper()
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("db", db) }, a.sessionMiddleware)
+	r.Handle(method, "/ui/", func(c *gin.Context) {
+		cookiePayload, _, _ := strings.Cut(cookie, ".")
+		if got, want := c.GetString("csrfToken"), a.csrfToken(cookiePayload); got != want {
+			t.Errorf("got CSRF token %q, want %q", got, want)
+		}
+		c.Status(http.StatusOK)
+	})
+
+	form := url.Values{uiCSRFField: {csrfToken}}
+	req := httptest.NewRequest(method, "/ui/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: uiSessionCookie, Value: cookie})
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestUISetSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keyExpiry := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		session   uiSession
+		wantUntil time.Time
+	}{
+		{"key without expiry", uiSession{KeyID: 1}, time.Now().Add(testUIAuth.sessionTTL)},
+		{"key expiring before the TTL", uiSession{KeyID: 1, ExpiresAt: keyExpiry.Unix()}, keyExpiry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/ui/login", nil)
+			testUIAuth.setSession(c, tt.session, testUIAuth.keySessionSecret(tt.session.KeyID))
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != uiSessionCookie {
+				t.Fatalf("got cookies %v", cookies)
+			}
+			payload, signature, _ := strings.Cut(cookies[0].Value, ".")
+			if signature != uiSessionSignature(testUIAuth.keySessionSecret(tt.session.KeyID), payload) {
+				t.Error("session isn't signed with the key's secret")
+			}
+			decoded, _ := base64.RawURLEncoding.DecodeString(payload)
+			var got uiSession
+			if err := json.Unmarshal(decoded, &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := got.ExpiresAt - tt.wantUntil.Unix(); diff < -1 || diff > 1 {
+				t.Errorf("got expiry %d, want %d", got.ExpiresAt, tt.wantUntil.Unix())
+			}
+		})
+	}
+}
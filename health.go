@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const codeNotReady = "not_ready"
+
+const (
+	readinessStarting     = "starting"
+	readinessReady        = "ready"
+	readinessNotReady     = "not_ready"
+	readinessShuttingDown = "shutting_down"
+
+	checkOK      = "ok"
+	checkFailing = "failing"
+)
+
+// readiness tracks whether the API can serve requests, i.e. the database is reachable, migrated and has its issue types
+type readiness struct {
+	db *gorm.DB
+	// how long the database ping of a readiness check may take
+	timeout time.Duration
+
+	migrated         atomic.Bool
+	issueTypesLoaded atomic.Bool
+	// set on graceful shutdown, so that traffic is routed elsewhere while requests in flight finish
+	shuttingDown atomic.Bool
+}
+
+func newReadiness(db *gorm.DB, timeout time.Duration) *readiness {
+	return &readiness{db: db, timeout: timeout}
+}
+
+// started reports whether the startup preparation of the database is done
+func (r *readiness) started() bool {
+	return r.migrated.Load() && r.issueTypesLoaded.Load()
+}
+
+func (r *readiness) check(ctx context.Context) dto.ReadinessResponse {
+	checks := []dto.HealthCheck{
+		r.pingDB(ctx),
+		flagCheck("migrations", r.migrated.Load(), "migrations haven't been applied yet"),
+		flagCheck("issue_types", r.issueTypesLoaded.Load(), "issue types haven't been loaded yet"),
+	}
+
+	status := readinessReady
+	for _, c := range checks {
+		if c.Status != checkOK {
+			status = readinessNotReady
+		}
+	}
+	switch {
+	case r.shuttingDown.Load():
+		status = readinessShuttingDown
+	case !r.started():
+		status = readinessStarting
+	}
+	return dto.ReadinessResponse{Status: status, Checks: checks}
+}
+
+func (r *readiness) pingDB(ctx context.Context) dto.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// pinged without GORM, so that probes don't produce a trace each
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		slog.Error("Failed to get database connection pool", "error", err)
+		return dto.HealthCheck{Name: "database", Status: checkFailing, Error: "database not reachable"}
+	}
+	start := time.Now()
+	err = sqlDB.PingContext(ctx)
+	check := dto.HealthCheck{Name: "database", Status: checkOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		// the error names the database host and user, which aren't for unauthenticated clients
+		slog.Warn("Readiness check failed, database not reachable", "error", err)
+		check.Status, check.Error = checkFailing, "database not reachable"
+	}
+	return check
+}
+
+func flagCheck(name string, ok bool, failure string) dto.HealthCheck {
+	if !ok {
+		return dto.HealthCheck{Name: name, Status: checkFailing, Error: failure}
+	}
+	return dto.HealthCheck{Name: name, Status: checkOK}
+}
+
+// readyEndpoint is meant for readiness probes, so that no traffic is routed to replicas which can't serve it
+func (r *readiness) readyEndpoint(c *gin.Context) {
+	response := r.check(c.Request.Context())
+	status := http.StatusOK
+	if response.Status != readinessReady {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, response)
+}
+
+// healthEndpoint is meant for liveness probes. It only checks that the process serves requests,
+// as restarting it wouldn't help with e.g. a database outage.
+func healthEndpoint(c *gin.Context) {
+	c.JSON(http.StatusOK, dto.HealthResponse{Status: checkOK})
+}
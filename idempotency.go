@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	codeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	codeIdempotencyKeyReused     = "idempotency_key_reused"
+
+	maxIdempotencyKeyLength = 255
+	// claims older than this whose request never completed, e.g. as the process crashed, are taken over by retries
+	idempotencyKeyLease = time.Minute
+)
+
+// responseRecorder passes the response through while keeping a copy of its body
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyMiddleware stores the response to the first successful request with a given Idempotency-Key header
+// and replays it to retries, so that clients can safely retry requests whose outcome they don't know.
+// Keys are scoped to the client the request was authenticated as. Requests without the header are passed through.
+func idempotencyMiddleware(ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortWithProblem(c, http.StatusBadRequest, codeInvalidBody, "Idempotency-Key header is too long")
+			return
+		}
+
+		logger := getLogger(c.Request.Context())
+
+		db := c.MustGet("db").(*gorm.DB)
+
+		hash, err := requestHash(c)
+		if err != nil {
+			abortWithProblem(c, http.StatusBadRequest, codeInvalidBody, "Failed to read request body")
+			return
+		}
+
+		record, claimed, err := claimIdempotencyKey(db, c.GetString("submitToken"), key, hash, ttl)
+		if err != nil {
+			logger.Error("Database write error", "error", err)
+			abortWithProblem(c, http.StatusInternalServerError, codeDatabaseWriteError, "Database write error")
+			return
+		}
+		if !claimed {
+			replayIdempotentResponse(c, record, hash)
+			return
+		}
+
+		// the key must be stored or released even if the client disconnected, or it would stay claimed
+		storeDB := db.WithContext(context.WithoutCancel(c.Request.Context()))
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		defer func() {
+			// the handler panicked, the key is released so that the request can be retried
+			if !completed {
+				releaseIdempotencyKey(c, storeDB, record)
+			}
+		}()
+		c.Next()
+		completed = true
+
+		storeIdempotentResponse(c, storeDB, record, recorder)
+	}
+}
+
+// claimIdempotencyKey creates the record of a client's key, relying on the primary key to detect concurrent or earlier requests,
+// in which case their record is returned instead. Expired records and abandoned claims are replaced.
+func claimIdempotencyKey(db *gorm.DB, client string, key string, hash string, ttl time.Duration) (models.IdempotencyKey, bool, error) {
+	var existing models.IdempotencyKey
+	// a second attempt after replacing a record, which may fail again if a concurrent retry replaced it first
+	for attempt := 0; attempt < 2; attempt++ {
+		record := models.IdempotencyKey{Client: client, Key: key, RequestHash: hash}
+		err := db.Create(&record).Error
+		if err == nil {
+			return record, true, nil
+		} else if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return record, false, err
+		}
+
+		if err := db.Where("client = ? AND key = ?", client, key).First(&existing).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			// released in the meantime
+			continue
+		} else if err != nil {
+			return existing, false, err
+		}
+		if !replaceableIdempotencyKey(existing, ttl, time.Now()) {
+			return existing, false, nil
+		}
+		// only deleted if it's still the same record
+		if err := db.Where("client = ? AND key = ? AND created_at = ?", client, key, existing.CreatedAt).Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return existing, false, err
+		}
+	}
+	// contended by concurrent retries, reported as in progress
+	return models.IdempotencyKey{Client: client, Key: key, RequestHash: hash}, false, nil
+}
+
+// replaceableIdempotencyKey reports whether a record has expired, or was claimed by a request which never completed
+func replaceableIdempotencyKey(record models.IdempotencyKey, ttl time.Duration, now time.Time) bool {
+	age := now.Sub(record.CreatedAt)
+	if age > ttl {
+		return true
+	}
+	return record.StatusCode == 0 && age > idempotencyKeyLease
+}
+
+// requestHash identifies a request by its method, path and body, restoring the body for the next handlers
+func requestHash(c *gin.Context) (string, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func replayIdempotentResponse(c *gin.Context, record models.IdempotencyKey, hash string) {
+	logger := getLogger(c.Request.Context())
+
+	switch {
+	case record.RequestHash != hash:
+		abortWithProblem(c, http.StatusUnprocessableEntity, codeIdempotencyKeyReused, "Idempotency-Key was already used for a different request")
+	case record.StatusCode == 0:
+		abortWithProblem(c, http.StatusConflict, codeIdempotencyKeyInProgress, "A request with this Idempotency-Key is still being processed")
+	default:
+		logger.Debug("Replaying stored response", "client", record.Client, "idempotencyKey", record.Key)
+		c.Header("Idempotent-Replayed", "true")
+		if record.ETag != "" {
+			c.Header("ETag", record.ETag)
+		}
+		if record.Location != "" {
+			c.Header("Location", record.Location)
+		}
+		c.Data(record.StatusCode, record.ContentType, record.Response)
+		c.Abort()
+	}
+}
+
+// storeIdempotentResponse keeps successful responses for replaying, and releases the key otherwise so that the request can be retried
+func storeIdempotentResponse(c *gin.Context, db *gorm.DB, record models.IdempotencyKey, recorder *responseRecorder) {
+	logger := getLogger(c.Request.Context())
+
+	status := recorder.Status()
+	var err error
+	if status >= 200 && status < 300 {
+		err = db.Model(&record).Updates(models.IdempotencyKey{
+			StatusCode:  status,
+			ContentType: recorder.Header().Get("Content-Type"),
+			ETag:        recorder.Header().Get("ETag"),
+			Location:    recorder.Header().Get("Location"),
+			Response:    recorder.body.Bytes(),
+		}).Error
+	} else {
+		releaseIdempotencyKey(c, db, record)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to store idempotent response", "error", err, "idempotencyKey", record.Key)
+	}
+}
+
+func releaseIdempotencyKey(c *gin.Context, db *gorm.DB, record models.IdempotencyKey) {
+	if err := db.Delete(&record).Error; err != nil {
+		getLogger(c.Request.Context()).Error("Failed to release idempotency key", "error", err, "idempotencyKey", record.Key)
+	}
+}
+
+// purgeIdempotencyKeys periodically deletes stored responses older than ttl
+func purgeIdempotencyKeys(ctx context.Context, db *gorm.DB, ttl time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		result := db.WithContext(ctx).Where("created_at < ?", time.Now().Add(-ttl)).Delete(&models.IdempotencyKey{})
+		if result.Error != nil {
+			slog.Error("Failed to purge expired idempotency keys", "error", result.Error)
+		} else if result.RowsAffected > 0 {
+			slog.Debug("Purged expired idempotency keys", "count", result.RowsAffected)
+		}
+	}
+}
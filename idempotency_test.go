@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReplaceableIdempotencyKey(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	ttl := 24 * time.Hour
+
+	tests := []struct {
+		name       string
+		age        time.Duration
+		statusCode int
+		want       bool
+	}{
+		{"fresh claim", time.Second, 0, false},
+		{"claim within lease", idempotencyKeyLease, 0, false},
+		{"abandoned claim", idempotencyKeyLease + time.Second, 0, true},
+		{"stored response", idempotencyKeyLease + time.Second, http.StatusCreated, false},
+		{"stored response at TTL", ttl, http.StatusCreated, false},
+		{"expired response", ttl + time.Second, http.StatusCreated, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := models.IdempotencyKey{Key: "k", StatusCode: tt.statusCode, CreatedAt: now.Add(-tt.age)}
+			if got := replaceableIdempotencyKey(record, ttl, now); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestHash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hash := func(method string, path string, body string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(method, path, strings.NewReader(body))
+		h, err := requestHash(c)
+		if err != nil {
+			t.Fatalf("requestHash: %v", err)
+		}
+		return h
+	}
+
+	base := hash(http.MethodPost, "/v1/submit/report", `{"satisfied":true}`)
+	if got := hash(http.MethodPost, "/v1/submit/report", `{"satisfied":true}`); got != base {
+		t.Error("same request hashed differently")
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"method", http.MethodPatch, "/v1/submit/report", `{"satisfied":true}`},
+		{"path", http.MethodPost, "/submit/report", `{"satisfied":true}`},
+		{"body", http.MethodPost, "/v1/submit/report", `{"satisfied":false}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hash(tt.method, tt.path, tt.body) == base {
+				t.Errorf("different %s hashed the same", tt.name)
+			}
+		})
+	}
+}
+
+func TestReplayIdempotentResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		record     models.IdempotencyKey
+		wantStatus int
+		wantBody   string
+	}{
+		{"different request", models.IdempotencyKey{RequestHash: "other", StatusCode: http.StatusCreated}, http.StatusUnprocessableEntity, codeIdempotencyKeyReused},
+		{"in progress", models.IdempotencyKey{RequestHash: "hash"}, http.StatusConflict, codeIdempotencyKeyInProgress},
+		{"stored", models.IdempotencyKey{RequestHash: "hash", StatusCode: http.StatusCreated, ContentType: "application/json", Response: []byte(`{"uuid":"x"}`)}, http.StatusCreated, `{"uuid":"x"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/submit/report", nil)
+
+			replayIdempotentResponse(c, tt.record, "hash")
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("got body %s, want it to contain %s", w.Body, tt.wantBody)
+			}
+			if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != (tt.record.StatusCode != 0 && tt.record.RequestHash == "hash") {
+				t.Errorf("got Idempotent-Replayed %v", replayed)
+			}
+		})
+	}
+}
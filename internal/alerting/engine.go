@@ -0,0 +1,251 @@
+package alerting
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/reports"
+	"gorm.io/gorm"
+)
+
+// arbitrary key of the Postgres advisory lock which makes only one replica evaluate rules at a time
+const evaluationLockKey = 0x66656564
+
+// Engine periodically evaluates rules and notifies about alerts which start firing, keep firing and resolve
+type Engine struct {
+	db        *gorm.DB
+	rules     []Rule
+	notifiers []Notifier
+	// how often firing alerts are notified again, 0 to never repeat
+	repeatInterval time.Duration
+}
+
+func NewEngine(db *gorm.DB, rules []Rule, notifiers []Notifier, repeatInterval time.Duration) *Engine {
+	return &Engine{db: db, rules: rules, notifiers: notifiers, repeatInterval: repeatInterval}
+}
+
+// Run evaluates the rules every interval until the context is cancelled
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := e.Evaluate(ctx); err != nil {
+			slog.Error("Failed to evaluate alerting rules", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pendingNotification is sent once the alert state change it announces is committed
+type pendingNotification struct {
+	rule         *Rule
+	notification Notification
+}
+
+// Evaluate evaluates all rules once, unless another replica is evaluating them at the moment
+func (e *Engine) Evaluate(ctx context.Context) error {
+	var pending []pendingNotification
+	err := e.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		pending = nil
+
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", evaluationLockKey).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			slog.Debug("Alerting rules are being evaluated by another replica, skipping")
+			return nil
+		}
+
+		var active []models.Alert
+		if err := tx.Where("resolved_at IS NULL").Find(&active).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for i := range e.rules {
+			notifications, err := e.evaluateRule(tx, &e.rules[i], active, now)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, notifications...)
+		}
+
+		// rules removed from the configuration can't resolve their alerts anymore
+		for _, alert := range active {
+			if !slices.ContainsFunc(e.rules, func(r Rule) bool { return r.Name == alert.Rule }) {
+				slog.Info("Resolving alert of a removed rule without notifying", "alertRule", alert.Rule, "alertGroup", alert.GroupKey)
+				if err := tx.Model(&alert).Update("resolved_at", now).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		e.notify(ctx, p.rule, p.notification)
+	}
+	return nil
+}
+
+// evaluateRule updates the alerts of a rule, returning the notifications to send about them
+func (e *Engine) evaluateRule(tx *gorm.DB, rule *Rule, active []models.Alert, now time.Time) ([]pendingNotification, error) {
+	firing, values, err := evaluateGroups(tx, rule, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []pendingNotification
+	add := func(alert models.Alert, status string) {
+		pending = append(pending, pendingNotification{rule: rule, notification: e.notification(rule, alert, status)})
+	}
+
+	// alerts which were firing already
+	for _, alert := range active {
+		if alert.Rule != rule.Name {
+			continue
+		}
+
+		s, stillFiring := firing[alert.GroupKey]
+		delete(firing, alert.GroupKey)
+
+		if !stillFiring {
+			alert.ResolvedAt = &now
+			if err := tx.Model(&alert).Update("resolved_at", now).Error; err != nil {
+				return nil, err
+			}
+			add(alert, StatusResolved)
+			continue
+		}
+
+		if e.repeatInterval > 0 && now.Sub(alert.LastNotifiedAt) >= e.repeatInterval {
+			alert.Value, alert.Reports, alert.LastNotifiedAt = values[alert.GroupKey], s.Total, now
+			if err := tx.Save(&alert).Error; err != nil {
+				return nil, err
+			}
+			add(alert, StatusFiring)
+		}
+	}
+
+	// alerts which started firing
+	for key, s := range firing {
+		alert := models.Alert{
+			Rule:           rule.Name,
+			GroupKey:       key,
+			Value:          values[key],
+			Reports:        s.Total,
+			StartedAt:      now,
+			LastNotifiedAt: now,
+		}
+		if err := tx.Create(&alert).Error; err != nil {
+			return nil, err
+		}
+		add(alert, StatusFiring)
+	}
+	return pending, nil
+}
+
+// evaluateGroups returns the stats of the groups for which the rule currently fires, and the values it fires with, by group key
+func evaluateGroups(tx *gorm.DB, rule *Rule, now time.Time) (map[string]reports.Stats, map[string]float64, error) {
+	filter := rule.filter
+	from := now.Add(-time.Duration(rule.Window))
+	filter.From = &from
+
+	stats, err := reports.GetStats(tx, filter, rule.GroupBy)
+	if err != nil {
+		return nil, nil, err
+	}
+	baselines, err := ruleBaselines(tx, rule, from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	firing, values := firingGroups(rule, stats, baselines)
+	return firing, values, nil
+}
+
+// ruleBaselines returns the average number of reports per window of each group within the rule's baseline windows
+// preceding the evaluated window starting at from, or nil if the rule's condition doesn't compare to a baseline
+func ruleBaselines(tx *gorm.DB, rule *Rule, from time.Time) (map[string]float64, error) {
+	if rule.Condition != ConditionSpike {
+		return nil, nil
+	}
+
+	filter := rule.filter
+	baselineFrom := from.Add(-time.Duration(rule.Window) * time.Duration(rule.BaselineWindows))
+	filter.From, filter.To = &baselineFrom, &from
+
+	stats, err := reports.GetStats(tx, filter, rule.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	baselines := make(map[string]float64)
+	for _, s := range stats {
+		baselines[groupKey(s.Group)] = float64(s.Total) / float64(rule.BaselineWindows)
+	}
+	return baselines, nil
+}
+
+// firingGroups returns the stats of the groups for which the rule fires, and the values it fires with, by group key
+func firingGroups(rule *Rule, stats []reports.Stats, baselines map[string]float64) (map[string]reports.Stats, map[string]float64) {
+	firing := make(map[string]reports.Stats)
+	values := make(map[string]float64)
+	for _, s := range stats {
+		key := groupKey(s.Group)
+		if ok, value := rule.firing(s, baselines[key]); ok {
+			firing[key] = s
+			values[key] = value
+		}
+	}
+	return firing, values
+}
+
+func (e *Engine) notification(rule *Rule, alert models.Alert, status string) Notification {
+	return Notification{
+		Status:      status,
+		Rule:        rule.Name,
+		Description: rule.Description,
+		GroupBy:     rule.GroupBy,
+		Group:       alert.GroupKey,
+		Condition:   rule.Condition,
+		Threshold:   rule.Threshold,
+		Value:       alert.Value,
+		Reports:     alert.Reports,
+		Window:      time.Duration(rule.Window).String(),
+		StartedAt:   alert.StartedAt,
+		ResolvedAt:  alert.ResolvedAt,
+	}
+}
+
+// notify sends the notification to the rule's notifiers. Failures are only logged,
+// as the alert state is already committed and the notification is not retried.
+func (e *Engine) notify(ctx context.Context, rule *Rule, n Notification) {
+	for _, notifier := range e.notifiers {
+		if len(rule.Notifiers) > 0 && !slices.Contains(rule.Notifiers, notifier.Name()) {
+			continue
+		}
+		if err := notifier.Notify(ctx, n); err != nil {
+			slog.Error("Failed to send alert notification", "error", err, "notifier", notifier.Name(), "alertRule", n.Rule, "alertGroup", n.Group, "alertStatus", n.Status)
+		}
+	}
+}
+
+// groupKey identifies a group of a rule, reports without a value of the grouping are grouped under ""
+func groupKey(group *string) string {
+	if group == nil {
+		return ""
+	}
+	return *group
+}
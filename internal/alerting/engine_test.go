@@ -0,0 +1,34 @@
+package alerting
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/Stogas/feedback-api/internal/reports"
+)
+
+func group(s string) *string {
+	return &s
+}
+
+func TestFiringGroups(t *testing.T) {
+	rule := &Rule{Condition: ConditionSpike, Threshold: 2}
+	stats := []reports.Stats{
+		{Group: group("ios"), Total: 30},
+		{Group: group("android"), Total: 30},
+		{Group: group("web"), Total: 3},
+		{Group: nil, Total: 5},
+	}
+	baselines := map[string]float64{"ios": 10, "android": 20}
+
+	firing, values := firingGroups(rule, stats, baselines)
+
+	if got, want := slices.Sorted(maps.Keys(firing)), []string{"", "ios", "web"}; !slices.Equal(got, want) {
+		t.Fatalf("got firing groups %v, want %v", got, want)
+	}
+	wantValues := map[string]float64{"ios": 3, "web": 3, "": 5}
+	if !maps.Equal(values, wantValues) {
+		t.Errorf("got values %v, want %v", values, wantValues)
+	}
+}
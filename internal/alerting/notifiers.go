@@ -0,0 +1,139 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/mail"
+)
+
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Notification describes a change of an alert, or a repeated reminder of a firing one
+type Notification struct {
+	Status      string     `json:"status"`
+	Rule        string     `json:"rule"`
+	Description string     `json:"description,omitempty"`
+	GroupBy     string     `json:"group_by,omitempty"`
+	Group       string     `json:"group,omitempty"`
+	Condition   string     `json:"condition"`
+	Threshold   float64    `json:"threshold"`
+	Value       float64    `json:"value"`
+	Reports     int64      `json:"reports"`
+	Window      string     `json:"window"`
+	StartedAt   time.Time  `json:"started_at"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Summary is a single line human-readable description of the notification
+func (n Notification) Summary() string {
+	subject := n.Rule
+	if n.GroupBy != "" {
+		subject = fmt.Sprintf("%s (%s=%s)", n.Rule, n.GroupBy, n.Group)
+	}
+	if n.Status == StatusResolved {
+		return fmt.Sprintf("[RESOLVED] %s", subject)
+	}
+
+	switch n.Condition {
+	case ConditionSatisfactionBelow:
+		return fmt.Sprintf("[FIRING] %s: satisfaction %.1f%% is below %.1f%% over the last %s (%d reports)",
+			subject, 100*n.Value, 100*n.Threshold, n.Window, n.Reports)
+	case ConditionSpike:
+		return fmt.Sprintf("[FIRING] %s: %d reports over the last %s, %.1f times the usual volume, above %.1f",
+			subject, n.Reports, n.Window, n.Value, n.Threshold)
+	}
+	return fmt.Sprintf("[FIRING] %s: %d reports over the last %s, above %.0f", subject, n.Reports, n.Window, n.Threshold)
+}
+
+// Notifier sends alert notifications somewhere
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// LogNotifier writes notifications to the service log
+type LogNotifier struct{}
+
+func (LogNotifier) Name() string { return "log" }
+
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	level := slog.LevelWarn
+	if n.Status == StatusResolved {
+		level = slog.LevelInfo
+	}
+	slog.Log(ctx, level, "Alert notification", "summary", n.Summary(), "alertRule", n.Rule, "alertGroup", n.Group, "alertStatus", n.Status, "value", n.Value)
+	return nil
+}
+
+// WebhookNotifier POSTs notifications as JSON
+type WebhookNotifier struct {
+	// may be rotated while running, as it may contain a token
+	url    atomic.Pointer[string]
+	Client *http.Client
+}
+
+// NewWebhookNotifier sends requests with transport, or the default one if nil
+func NewWebhookNotifier(url string, transport http.RoundTripper) *WebhookNotifier {
+	w := &WebhookNotifier{Client: &http.Client{Timeout: 10 * time.Second, Transport: transport}}
+	w.SetURL(url)
+	return w
+}
+
+// SetURL changes the URL notifications are posted to from now on
+func (w *WebhookNotifier) SetURL(url string) {
+	w.url.Store(&url)
+}
+
+func (*WebhookNotifier) Name() string { return "webhook" }
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *w.url.Load(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// EmailNotifier sends notifications as plain text emails
+type EmailNotifier struct {
+	Sender *mail.Sender
+	To     []string
+}
+
+func (*EmailNotifier) Name() string { return "email" }
+
+func (e *EmailNotifier) Notify(_ context.Context, n Notification) error {
+	body, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return err
+	}
+	return e.Sender.Send(mail.Message{
+		To:      e.To,
+		Subject: n.Summary(),
+		Body:    n.Summary() + "\n\n" + string(body) + "\n",
+	})
+}
@@ -0,0 +1,53 @@
+package alerting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotificationSummary(t *testing.T) {
+	tests := []struct {
+		name string
+		n    Notification
+		want string
+	}{
+		{"resolved", Notification{Status: StatusResolved, Rule: "r", GroupBy: "issue", Group: "3"}, "[RESOLVED] r (issue=3)"},
+		{"satisfaction", Notification{Status: StatusFiring, Rule: "r", Condition: ConditionSatisfactionBelow, Value: 0.5, Threshold: 0.7, Window: "1h0m0s", Reports: 10},
+			"[FIRING] r: satisfaction 50.0% is below 70.0% over the last 1h0m0s (10 reports)"},
+		{"count", Notification{Status: StatusFiring, Rule: "r", Condition: ConditionCountAbove, Value: 21, Threshold: 20, Window: "15m0s", Reports: 21},
+			"[FIRING] r: 21 reports over the last 15m0s, above 20"},
+		{"spike", Notification{Status: StatusFiring, Rule: "r", Condition: ConditionSpike, Value: 3.5, Threshold: 3, Window: "15m0s", Reports: 35},
+			"[FIRING] r: 35 reports over the last 15m0s, 3.5 times the usual volume, above 3.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.n.Summary(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierSetURL(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	w := NewWebhookNotifier(srv.URL+"/old-token", nil)
+	if err := w.Notify(context.Background(), Notification{Rule: "r"}); err != nil {
+		t.Fatal(err)
+	}
+	w.SetURL(srv.URL + "/new-token")
+	if err := w.Notify(context.Background(), Notification{Rule: "r"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 2 || paths[0] != "/old-token" || paths[1] != "/new-token" {
+		t.Errorf("got requests to %v", paths)
+	}
+}
@@ -0,0 +1,142 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/reports"
+)
+
+const (
+	// fires when the share of satisfied reports is below the threshold
+	ConditionSatisfactionBelow = "satisfaction_below"
+	// fires when the number of reports is above the threshold, an absolute number of reports
+	ConditionCountAbove = "count_above"
+	// fires when the number of reports is more than threshold times the average of the preceding windows,
+	// e.g. an issue type being reported 3 times as often as usual
+	ConditionSpike = "spike"
+
+	defaultBaselineWindows = 4
+)
+
+// Rule is evaluated over the reports created within the last Window
+type Rule struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// report filters as URL query parameters, the same as accepted by the admin endpoints, e.g. "issue_id=3&metadata.platform=ios"
+	Filter string `json:"filter"`
+	// evaluates the rule separately per group, e.g. "issue" or "metadata.project" (see reports.GroupByExpr)
+	GroupBy   string   `json:"group_by"`
+	Window    Duration `json:"window"`
+	Condition string   `json:"condition"`
+	Threshold float64  `json:"threshold"`
+	// groups with fewer reports in the window don't fire
+	MinReports int64 `json:"min_reports"`
+	// number of windows preceding the evaluated one whose average is the baseline of the spike condition
+	BaselineWindows int `json:"baseline_windows"`
+	// names of the notifiers to send to, all if empty
+	Notifiers []string `json:"notifiers"`
+
+	filter reports.Filter
+}
+
+// Duration is a time.Duration read from a JSON string such as "1h"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadRules reads and validates the rules from a JSON file containing an array of rules
+func LoadRules(path string) ([]Rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse alerting rules: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid alerting rule %d (%q): %w", i, rules[i].Name, err)
+		}
+		if names[rules[i].Name] {
+			return nil, fmt.Errorf("duplicate alerting rule name %q", rules[i].Name)
+		}
+		names[rules[i].Name] = true
+	}
+	return rules, nil
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("'name' is required")
+	}
+	if r.Window <= 0 {
+		return fmt.Errorf("'window' must be positive")
+	}
+	switch r.Condition {
+	case ConditionSatisfactionBelow:
+		if r.Threshold < 0 || r.Threshold > 1 {
+			return fmt.Errorf("'threshold' must be a ratio between 0 and 1")
+		}
+	case ConditionCountAbove:
+	case ConditionSpike:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("'threshold' must be a positive ratio to the baseline")
+		}
+		if r.BaselineWindows < 0 {
+			return fmt.Errorf("'baseline_windows' must not be negative")
+		} else if r.BaselineWindows == 0 {
+			r.BaselineWindows = defaultBaselineWindows
+		}
+	default:
+		return fmt.Errorf("unknown condition %q, expected %q, %q or %q", r.Condition, ConditionSatisfactionBelow, ConditionCountAbove, ConditionSpike)
+	}
+	if _, err := reports.GroupByExpr(r.GroupBy); err != nil {
+		return err
+	}
+
+	q, err := url.ParseQuery(r.Filter)
+	if err != nil {
+		return fmt.Errorf("invalid 'filter': %w", err)
+	}
+	if q.Has("from") || q.Has("to") {
+		return fmt.Errorf("'filter' can't limit the creation time, use 'window' instead")
+	}
+	if r.filter, err = reports.ParseFilter(q); err != nil {
+		return fmt.Errorf("invalid 'filter': %w", err)
+	}
+	return nil
+}
+
+// firing reports whether a group's stats satisfy the rule's condition, and the value compared to the threshold.
+// baseline is the group's average number of reports in the preceding windows, only used by the spike condition.
+func (r *Rule) firing(s reports.Stats, baseline float64) (bool, float64) {
+	switch r.Condition {
+	case ConditionSatisfactionBelow:
+		return s.Total >= r.MinReports && s.Ratio() < r.Threshold, s.Ratio()
+	case ConditionSpike:
+		// groups which were (almost) never reported before compare against a single report per window
+		ratio := float64(s.Total) / max(baseline, 1)
+		return s.Total >= r.MinReports && ratio > r.Threshold, ratio
+	default:
+		return s.Total >= r.MinReports && float64(s.Total) > r.Threshold, float64(s.Total)
+	}
+}
@@ -0,0 +1,105 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/reports"
+)
+
+var loadRulesTests = []struct {
+	name    string
+	rules   string
+	wantErr string
+}{
+	{"satisfaction", `[{"name":"a","window":"1h","condition":"satisfaction_below","threshold":0.7}]`, ""},
+	{"count", `[{"name":"a","window":"1h","condition":"count_above","threshold":20,"group_by":"issue"}]`, ""},
+	{"spike", `[{"name":"a","window":"15m","condition":"spike","threshold":3,"filter":"issue_id=3"}]`, ""},
+	{"missing name", `[{"window":"1h","condition":"count_above"}]`, "'name' is required"},
+	{"missing window", `[{"name":"a","condition":"count_above"}]`, "'window' must be positive"},
+	{"invalid window", `[{"name":"a","window":"an hour","condition":"count_above"}]`, "failed to parse"},
+	{"unknown condition", `[{"name":"a","window":"1h","condition":"count_below"}]`, "unknown condition"},
+	{"ratio above 1", `[{"name":"a","window":"1h","condition":"satisfaction_below","threshold":70}]`, "between 0 and 1"},
+	{"spike without threshold", `[{"name":"a","window":"1h","condition":"spike"}]`, "positive ratio"},
+	{"negative baseline", `[{"name":"a","window":"1h","condition":"spike","threshold":2,"baseline_windows":-1}]`, "'baseline_windows'"},
+	{"invalid grouping", `[{"name":"a","window":"1h","condition":"count_above","group_by":"comment"}]`, "group"},
+	{"filter by time", `[{"name":"a","window":"1h","condition":"count_above","filter":"from=2024-01-01T00:00:00Z"}]`, "use 'window'"},
+	{"invalid filter", `[{"name":"a","window":"1h","condition":"count_above","filter":"satisfied=maybe"}]`, "invalid 'filter'"},
+	{"duplicate name", `[{"name":"a","window":"1h","condition":"count_above"},{"name":"a","window":"1h","condition":"count_above"}]`, "duplicate"},
+}
+
+func TestLoadRules(t *testing.T) {
+	for _, tt := range loadRulesTests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			if err := os.WriteFile(path, []byte(tt.rules), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadRules(path)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRulesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	rules := `[{"name":"a","window":"15m","condition":"spike","threshold":3,"filter":"issue_id=3"}]`
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded[0].BaselineWindows != defaultBaselineWindows {
+		t.Errorf("got baseline windows %d, want %d", loaded[0].BaselineWindows, defaultBaselineWindows)
+	}
+	if time.Duration(loaded[0].Window) != 15*time.Minute {
+		t.Errorf("got window %v", time.Duration(loaded[0].Window))
+	}
+	if loaded[0].filter.IssueID == nil || *loaded[0].filter.IssueID != 3 {
+		t.Errorf("got filter %+v", loaded[0].filter)
+	}
+}
+
+var firingTests = []struct {
+	name      string
+	rule      Rule
+	stats     reports.Stats
+	baseline  float64
+	want      bool
+	wantValue float64
+}{
+	{"satisfaction below", Rule{Condition: ConditionSatisfactionBelow, Threshold: 0.7}, reports.Stats{Total: 10, Satisfied: 6}, 0, true, 0.6},
+	{"satisfaction at threshold", Rule{Condition: ConditionSatisfactionBelow, Threshold: 0.6}, reports.Stats{Total: 10, Satisfied: 6}, 0, false, 0.6},
+	{"satisfaction too few reports", Rule{Condition: ConditionSatisfactionBelow, Threshold: 0.7, MinReports: 11}, reports.Stats{Total: 10, Satisfied: 6}, 0, false, 0.6},
+	{"count above", Rule{Condition: ConditionCountAbove, Threshold: 20}, reports.Stats{Total: 21}, 0, true, 21},
+	{"count at threshold", Rule{Condition: ConditionCountAbove, Threshold: 20}, reports.Stats{Total: 20}, 100, false, 20},
+	{"spike", Rule{Condition: ConditionSpike, Threshold: 3}, reports.Stats{Total: 31}, 10, true, 3.1},
+	{"spike at threshold", Rule{Condition: ConditionSpike, Threshold: 3}, reports.Stats{Total: 30}, 10, false, 3},
+	{"usual volume", Rule{Condition: ConditionSpike, Threshold: 3}, reports.Stats{Total: 100}, 50, false, 2},
+	{"spike without baseline", Rule{Condition: ConditionSpike, Threshold: 3}, reports.Stats{Total: 4}, 0, true, 4},
+	{"spike below baseline floor", Rule{Condition: ConditionSpike, Threshold: 3}, reports.Stats{Total: 2}, 0.25, false, 2},
+	{"spike too few reports", Rule{Condition: ConditionSpike, Threshold: 3, MinReports: 10}, reports.Stats{Total: 4}, 0, false, 4},
+}
+
+func TestRuleFiring(t *testing.T) {
+	for _, tt := range firingTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, value := tt.rule.firing(tt.stats, tt.baseline)
+			if got != tt.want || value != tt.wantValue {
+				t.Errorf("got %v with %v, want %v with %v", got, value, tt.want, tt.wantValue)
+			}
+		})
+	}
+}
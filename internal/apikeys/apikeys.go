@@ -0,0 +1,140 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Roles, each allowed everything the previous ones are
+const (
+	// aggregated stats and issue types
+	RoleReader = "reader"
+	// individual reports, including comments and metadata
+	RoleExporter = "exporter"
+	// changes to issue types and digests
+	RoleAdmin = "admin"
+)
+
+var Roles = []string{RoleReader, RoleExporter, RoleAdmin}
+
+const (
+	keyPrefix = "fbk_"
+	// shown in listings to recognize keys
+	displayPrefixLength = len(keyPrefix) + 8
+	// last use is only written once per this period, instead of on every request
+	lastUsedResolution = time.Minute
+)
+
+var (
+	ErrNotFound    = errors.New("API key not found")
+	ErrInvalidKey  = errors.New("API key is unknown, revoked or expired")
+	ErrInvalidRole = fmt.Errorf("role must be one of %s", strings.Join(Roles, ", "))
+	ErrEmptyName   = errors.New("API key name is empty")
+)
+
+// ValidRole reports whether role is a known role
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// Allows reports whether role grants everything required is allowed
+func Allows(role string, required string) bool {
+	i := slices.Index(Roles, role)
+	return i != -1 && i >= slices.Index(Roles, required)
+}
+
+// Hash returns the hex SHA-256 of a key. Keys are random, so a slow hash isn't needed.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create generates a key, storing only its hash. The key itself is returned once and can't be recovered later.
+func Create(db *gorm.DB, name string, role string, expiresAt *time.Time) (string, models.APIKey, error) {
+	apiKey := models.APIKey{Name: strings.TrimSpace(name), Role: role, ExpiresAt: expiresAt}
+	if apiKey.Name == "" {
+		return "", apiKey, ErrEmptyName
+	}
+	if !ValidRole(role) {
+		return "", apiKey, ErrInvalidRole
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", apiKey, err
+	}
+	key := keyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	apiKey.Prefix = key[:displayPrefixLength]
+	apiKey.Hash = Hash(key)
+
+	err := db.Create(&apiKey).Error
+	return key, apiKey, err
+}
+
+// List returns all keys, including revoked and expired ones
+func List(db *gorm.DB) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := db.Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// Revoke makes a key unusable, ending the admin UI sessions logged in with it
+func Revoke(db *gorm.DB, id uint) (models.APIKey, error) {
+	apiKey, err := Find(db, id)
+	if err != nil || apiKey.RevokedAt != nil {
+		return apiKey, err
+	}
+	now := time.Now()
+	err = db.Model(&apiKey).Update("revoked_at", now).Error
+	return apiKey, err
+}
+
+// Find returns a key by its ID, whether it's usable or not
+func Find(db *gorm.DB, id uint) (models.APIKey, error) {
+	var apiKey models.APIKey
+	err := db.First(&apiKey, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apiKey, ErrNotFound
+	}
+	return apiKey, err
+}
+
+// Authenticate returns the usable key matching key
+func Authenticate(db *gorm.DB, key string) (models.APIKey, error) {
+	var apiKey models.APIKey
+	err := db.Where("hash = ?", Hash(key)).First(&apiKey).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apiKey, ErrInvalidKey
+	} else if err != nil {
+		return apiKey, err
+	}
+	if !Usable(apiKey) {
+		return apiKey, ErrInvalidKey
+	}
+	return apiKey, nil
+}
+
+// Usable reports whether a key is neither revoked nor expired
+func Usable(apiKey models.APIKey) bool {
+	return apiKey.RevokedAt == nil && (apiKey.ExpiresAt == nil || time.Now().Before(*apiKey.ExpiresAt))
+}
+
+// Touch records the use of a key, at most once per lastUsedResolution
+func Touch(db *gorm.DB, apiKey *models.APIKey) error {
+	now := time.Now()
+	if apiKey.LastUsedAt != nil && now.Sub(*apiKey.LastUsedAt) < lastUsedResolution {
+		return nil
+	}
+	apiKey.LastUsedAt = &now
+	return db.Model(apiKey).Update("last_used_at", now).Error
+}
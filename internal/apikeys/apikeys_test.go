@@ -0,0 +1,68 @@
+package apikeys
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/models"
+)
+
+func TestHash(t *testing.T) {
+	// echo -n fbk_test | sha256sum
+	const want = "71dae33ea5e2d5023f4f3cb90e95295d3ca5c33e833808992b3c04652daa5b2f"
+	if got := Hash("fbk_test"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestUsable(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		key  models.APIKey
+		want bool
+	}{
+		{name: "no expiry", key: models.APIKey{}, want: true},
+		{name: "not expired yet", key: models.APIKey{ExpiresAt: &future}, want: true},
+		{name: "expired", key: models.APIKey{ExpiresAt: &past}, want: false},
+		{name: "revoked", key: models.APIKey{RevokedAt: &past}, want: false},
+		{name: "revoked before expiry", key: models.APIKey{ExpiresAt: &future, RevokedAt: &past}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Usable(tt.key); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{RoleReader, RoleReader, true},
+		{RoleReader, RoleExporter, false},
+		{RoleReader, RoleAdmin, false},
+		{RoleExporter, RoleReader, true},
+		{RoleExporter, RoleExporter, true},
+		{RoleExporter, RoleAdmin, false},
+		{RoleAdmin, RoleReader, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"", RoleReader, false},
+		{"superuser", RoleReader, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+" as "+tt.required, func(t *testing.T) {
+			if got := Allows(tt.role, tt.required); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,18 +1,62 @@
 package config
 
 import (
-	"log/slog"
 	"os"
-	"strconv"
-	"strings"
+	"time"
 )
 
 type APIConfig struct {
-	Host        string
-	Port        int
-	Debug       bool
-	SubmitToken string
-	CorsOrigins []string
+	Host  string
+	Port  int
+	Debug bool
+	// accepted by the submission routes, which are open if there are neither tokens nor signing clients
+	SubmitTokens []SubmitToken
+	// backends signing their submissions with HMAC instead of sending a token
+	SubmitSigningClients []SigningClient
+	// how far the timestamp of signed requests may be from the server time
+	SubmitSignatureWindow time.Duration
+	CorsOrigins           []string
+	// validate requests against the OpenAPI document before they reach the handlers
+	OpenAPIValidation bool
+	// date the unversioned routes were superseded by /v1
+	LegacyRoutesDeprecatedAt time.Time
+	// announced removal date of the unversioned routes, zero if not planned yet
+	LegacyRoutesSunset time.Time
+	BatchMaxItems      int
+	// client-provided submission timestamps further than this from the server time are replaced by the server time
+	BatchMaxTimestampSkew time.Duration
+	// how long responses to requests with an Idempotency-Key header are kept for replaying
+	IdempotencyKeyTTL time.Duration
+	// share report stream events between replicas through Postgres LISTEN/NOTIFY
+	StreamPostgresNotify bool
+	StreamKeepAlive      time.Duration
+	AdminUIEnabled       bool
+	// signs admin UI sessions, required when the UI is enabled
+	AdminUISessionSecret string
+	// how long admin UI logins last
+	AdminUISessionTTL time.Duration
+	// allow logging in to the admin UI with API keys, may be disabled to require OIDC
+	AdminUIKeyLogin bool
+	// "env" to sync issue types from ISSUE_TYPES on startup, "api" to manage them through the admin API
+	IssueTypesMode string
+	// how long the database ping of readiness checks may take
+	ReadinessTimeout time.Duration
+}
+
+// SubmitToken is a token accepted by the submission routes. Several may be valid at once, so that they can be rotated.
+type SubmitToken struct {
+	// identifies the token in reports, logs and metrics
+	Label string
+	Token string
+	// zero if the token doesn't expire
+	ExpiresAt time.Time
+}
+
+// SigningClient is a backend which signs its submissions with a shared secret.
+// A client may have several secrets, so that they can be rotated.
+type SigningClient struct {
+	ID     string
+	Secret string
 }
 
 type DBConfig struct {
@@ -21,12 +65,53 @@ type DBConfig struct {
 	User     string
 	Password string
 	Name     string
+	// connection string or postgres:// URL replacing the host, port, user, database name and TLS settings
+	URL string
+	// "disable", "allow", "prefer", "require", "verify-ca" or "verify-full"
+	SSLMode string
+	// paths of the CA certificate verifying the server, and of the client certificate and key
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+	// shown in pg_stat_activity
+	ApplicationName string
+	// queries running longer are canceled by the server, 0 for no timeout
+	StatementTimeout time.Duration
+	// connection pool, 0 for no limit
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// how long to wait for the database to be reachable on startup before giving up
+	StartupMaxWait time.Duration
+	// top-level metadata keys which get an expression index for filtering and grouping
+	MetadataIndexKeys []string
 }
 
 type TraceConfig struct {
 	Enabled bool
-	Host    string
-	Port    int
+	// "grpc" or "http" (OTLP/HTTP with protobuf)
+	Protocol string
+	Host     string
+	Port     int
+	HTTPHost string
+	HTTPPort int
+	// export without TLS
+	Insecure bool
+	// CA certificate verifying the collector, the system's CAs if empty
+	TLSCAFile string
+	// client certificate and key for mutual TLS
+	TLSCertFile string
+	TLSKeyFile  string
+	// sent with each export, e.g. for authenticating to the collector
+	Headers map[string]string
+	// fraction of traces started by this service which are sampled, traces started by callers follow their sampling decision
+	SampleRatio float64
+	// deployment.environment resource attribute
+	Environment string
+	// trace context formats extracted from incoming and injected into outgoing requests:
+	// "tracecontext", "baggage", "b3" (single header), "b3multi", "jaeger" or "none"
+	Propagators []string
 }
 
 type LogsConfig struct {
@@ -35,13 +120,68 @@ type LogsConfig struct {
 	Source bool
 }
 
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+type AlertingConfig struct {
+	// JSON file with the alerting rules, alerting is disabled if not set
+	RulesFile          string
+	EvaluationInterval time.Duration
+	// how often notifications of still firing alerts are repeated, 0 to never repeat
+	RepeatInterval time.Duration
+	Log            bool
+	WebhookURL     string
+	EmailTo        []string
+}
+
+type DigestConfig struct {
+	// "daily" or "weekly", digests are disabled if not set
+	Schedule string
+	// time of day ("15:04") in the local time zone
+	Time    string
+	Weekday string
+	EmailTo []string
+	// maximum number of recent comments included
+	Comments int
+	// Go html/template file overriding the built-in template
+	TemplateFile string
+}
+
 type Config struct {
 	API        APIConfig
 	Database   DBConfig
 	Tracing    TraceConfig
 	Logs       LogsConfig
 	Metrics    MetricsConfig
+	SMTP       SMTPConfig
+	Alerting   AlertingConfig
+	Digest     DigestConfig
+	OIDC       OIDCConfig
+	Shutdown   ShutdownConfig
 	IssueTypes []string
+	// how often the config file is checked for changes to reload, 0 to only reload on SIGHUP
+	WatchInterval time.Duration
+}
+
+type OIDCConfig struct {
+	// OIDC login to the admin UI is disabled if not set
+	IssuerURL string
+	// where the provider configuration is discovered if not at the issuer, e.g. when the API reaches the provider by another host name
+	DiscoveryURL string
+	ClientID     string
+	ClientSecret string
+	// public URL of /ui/oidc/callback, as registered with the provider
+	RedirectURL string
+	Scopes      []string
+	// claim with the user's groups or roles, nested claims are separated by dots
+	RolesClaim string
+	// "<group>=<role>" pairs, users get the highest role of their groups
+	RoleMapping []string
 }
 
 type MetricsConfig struct {
@@ -49,84 +189,213 @@ type MetricsConfig struct {
 	Port int
 }
 
-func New() *Config {
-	return &Config{
-		IssueTypes: getEnvAsStringSliceRequired("ISSUE_TYPES"),
-		API: APIConfig{
-			Host:        getEnvAsString("API_LISTEN_HOST", "0.0.0.0"),
-			Port:        getEnvAsInt("API_LISTEN_PORT", 80),
-			Debug:       getEnvAsBool("API_DEBUG_MODE", false),
-			SubmitToken: getEnvAsString("API_SUBMIT_TOKEN", ""),
-			CorsOrigins: getEnvAsStringSlice("API_CORS_ORIGINS", []string{"*"}),
-		},
-		Database: DBConfig{
-			Host:     getEnvAsString("POSTGRES_HOST", "localhost"),
-			Port:     getEnvAsInt("POSTGRES_PORT", 5432),
-			User:     getEnvAsString("POSTGRES_USER", ""),
-			Password: getEnvAsString("POSTGRES_PASSWORD", ""),
-			Name:     getEnvAsString("POSTGRES_DATABASE", ""),
-		},
-		Tracing: TraceConfig{
-			Enabled: getEnvAsBool("OTLP_TRACING_ENABLED", false),
-			Host:    getEnvAsString("OTLP_GRPC_HOST", "127.0.0.1"),
-			Port:    getEnvAsInt("OTLP_GRPC_PORT", 4317),
-		},
-		Logs: LogsConfig{
-			JSON:   getEnvAsBool("LOGS_JSON", true),
-			Debug:  getEnvAsBool("LOGS_DEBUG", false),
-			Source: getEnvAsBool("LOGS_SOURCE", false),
-		},
-		Metrics: MetricsConfig{
-			Host: getEnvAsString("METRICS_HOST", "0.0.0.0"),
-			Port: getEnvAsInt("METRICS_PORT", 2222),
-		},
+type ShutdownConfig struct {
+	// how long to keep serving after being marked not ready, until load balancers stop routing requests to the replica
+	PreStopDelay time.Duration
+	// how long requests in flight may take to finish
+	DrainTimeout time.Duration
+	// how long each of stopping the background workers, the metrics listener and flushing traces may take
+	Timeout time.Duration
+}
+
+// New reads the configuration from the config file (if CONFIG_FILE is set) and environment variables,
+// which take precedence over the file. All invalid values are returned at once, as Errors.
+func New() (*Config, error) {
+	conf, _, err := Load()
+	return conf, err
+}
+
+// Load is New, also returning the resolved values along with where they were set
+func Load() (*Config, []Value, error) {
+	l := newLoader(os.Getenv(FileEnvVar))
+
+	issueTypesMode := l.getString("ISSUE_TYPES_MODE", "env")
+	// only used to seed an empty database in "api" mode
+	issueTypes := l.getStringSlice("ISSUE_TYPES", nil)
+
+	conf := &Config{
+		IssueTypes:    issueTypes,
+		WatchInterval: l.getDuration("CONFIG_WATCH_INTERVAL", 10*time.Second),
+		API:           l.loadAPI(issueTypesMode),
+		Database:      l.loadDatabase(),
+		Tracing:       l.loadTracing(),
+		Logs:          l.loadLogs(),
+		Metrics:       l.loadMetrics(),
+		Shutdown:      l.loadShutdown(),
+		SMTP:          l.loadSMTP(),
+		Alerting:      l.loadAlerting(),
+		Digest:        l.loadDigest(),
+		OIDC:          l.loadOIDC(),
+	}
+
+	l.checkUnknownFileKeys()
+	l.errs = append(l.errs, conf.validate()...)
+	if len(l.errs) > 0 {
+		return conf, l.values, l.errs
+	}
+	return conf, l.values, nil
+}
+
+// LoadDatabase reads and validates only the database settings, for commands which don't need the rest of the configuration
+func LoadDatabase() (DBConfig, error) {
+	l := newLoader(os.Getenv(FileEnvVar))
+	conf := &Config{Database: l.loadDatabase()}
+
+	var v checker
+	conf.validateDatabase(&v)
+	l.errs = append(l.errs, v.errs...)
+	if len(l.errs) > 0 {
+		return conf.Database, l.errs
+	}
+	return conf.Database, nil
+}
+
+// Sections are loaded in the order their values are listed by "config print"
+
+func (l *loader) loadAPI(issueTypesMode string) APIConfig {
+	return APIConfig{
+		Host:                  l.getString("API_LISTEN_HOST", "0.0.0.0"),
+		Port:                  l.getInt("API_LISTEN_PORT", 80),
+		Debug:                 l.getBool("API_DEBUG_MODE", false),
+		SubmitTokens:          l.getSubmitTokens("API_SUBMIT_TOKENS", "API_SUBMIT_TOKEN"),
+		SubmitSigningClients:  l.getSigningClients("API_SUBMIT_SIGNING_KEYS"),
+		SubmitSignatureWindow: l.getDuration("API_SUBMIT_SIGNATURE_WINDOW", 5*time.Minute),
+		CorsOrigins:           l.getStringSlice("API_CORS_ORIGINS", []string{"*"}),
+
+		OpenAPIValidation:        l.getBool("API_OPENAPI_VALIDATION", false),
+		LegacyRoutesDeprecatedAt: l.getTime("API_LEGACY_ROUTES_DEPRECATED_AT", time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)),
+		LegacyRoutesSunset:       l.getTime("API_LEGACY_ROUTES_SUNSET", time.Time{}),
+
+		BatchMaxItems:         l.getInt("API_BATCH_MAX_ITEMS", 100),
+		BatchMaxTimestampSkew: l.getDuration("API_BATCH_MAX_TIMESTAMP_SKEW", 72*time.Hour),
+		IdempotencyKeyTTL:     l.getDuration("API_IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+
+		StreamPostgresNotify: l.getBool("API_STREAM_POSTGRES_NOTIFY", false),
+		StreamKeepAlive:      l.getDuration("API_STREAM_KEEPALIVE_INTERVAL", 15*time.Second),
+
+		AdminUIEnabled:       l.getBool("API_ADMIN_UI_ENABLED", false),
+		AdminUISessionSecret: l.getSecret("API_ADMIN_UI_SESSION_SECRET"),
+		AdminUISessionTTL:    l.getDuration("API_ADMIN_UI_SESSION_TTL", 12*time.Hour),
+		AdminUIKeyLogin:      l.getBool("API_ADMIN_UI_KEY_LOGIN", true),
+		IssueTypesMode:       issueTypesMode,
+		ReadinessTimeout:     l.getDuration("API_READINESS_TIMEOUT", 2*time.Second),
+	}
+}
+
+func (l *loader) loadDatabase() DBConfig {
+	return DBConfig{
+		Host:     l.getString("POSTGRES_HOST", "localhost"),
+		Port:     l.getInt("POSTGRES_PORT", 5432),
+		User:     l.getString("POSTGRES_USER", ""),
+		Password: l.getSecret("POSTGRES_PASSWORD"),
+		Name:     l.getString("POSTGRES_DATABASE", ""),
+		// may contain the password
+		URL: l.getSecret("POSTGRES_URL"),
+
+		SSLMode:     l.getString("POSTGRES_SSLMODE", "disable"),
+		SSLRootCert: l.getString("POSTGRES_SSLROOTCERT", ""),
+		SSLCert:     l.getString("POSTGRES_SSLCERT", ""),
+		SSLKey:      l.getString("POSTGRES_SSLKEY", ""),
+
+		ApplicationName:  l.getString("POSTGRES_APPLICATION_NAME", "feedback-api"),
+		StatementTimeout: l.getDuration("POSTGRES_STATEMENT_TIMEOUT", 0),
+
+		MaxOpenConns:    l.getInt("POSTGRES_MAX_OPEN_CONNS", 0),
+		MaxIdleConns:    l.getInt("POSTGRES_MAX_IDLE_CONNS", 2),
+		ConnMaxLifetime: l.getDuration("POSTGRES_CONN_MAX_LIFETIME", 0),
+		ConnMaxIdleTime: l.getDuration("POSTGRES_CONN_MAX_IDLE_TIME", 0),
+		StartupMaxWait:  l.getDuration("POSTGRES_STARTUP_MAX_WAIT", 5*time.Minute),
+
+		MetadataIndexKeys: l.getStringSlice("METADATA_INDEXED_KEYS", nil),
 	}
 }
 
-// Simple helper function to read an environment or return a default value
-func getEnvAsString(key string, defaultVal string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+func (l *loader) loadTracing() TraceConfig {
+	return TraceConfig{
+		Enabled:  l.getBool("OTLP_TRACING_ENABLED", false),
+		Protocol: l.getString("OTLP_PROTOCOL", "grpc"),
+		Host:     l.getString("OTLP_GRPC_HOST", "127.0.0.1"),
+		Port:     l.getInt("OTLP_GRPC_PORT", 4317),
+		HTTPHost: l.getString("OTLP_HTTP_HOST", "127.0.0.1"),
+		HTTPPort: l.getInt("OTLP_HTTP_PORT", 4318),
+
+		Insecure:    l.getBool("OTLP_INSECURE", true),
+		TLSCAFile:   l.getString("OTLP_TLS_CA_FILE", ""),
+		TLSCertFile: l.getString("OTLP_TLS_CERT_FILE", ""),
+		TLSKeyFile:  l.getString("OTLP_TLS_KEY_FILE", ""),
+		Headers:     l.getHeaders("OTLP_HEADERS"),
+
+		SampleRatio: l.getFloat("OTLP_SAMPLE_RATIO", 1),
+		Environment: l.getString("OTLP_DEPLOYMENT_ENVIRONMENT", ""),
+		Propagators: l.getStringSlice("OTLP_PROPAGATORS", []string{"tracecontext", "baggage", "b3multi"}),
 	}
+}
 
-	return defaultVal
+func (l *loader) loadLogs() LogsConfig {
+	return LogsConfig{
+		JSON:   l.getBool("LOGS_JSON", true),
+		Debug:  l.getBool("LOGS_DEBUG", false),
+		Source: l.getBool("LOGS_SOURCE", false),
+	}
 }
 
-// Simple helper function to read an environment variable into integer or return a default value
-func getEnvAsInt(name string, defaultVal int) int {
-	valueStr := getEnvAsString(name, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
+func (l *loader) loadMetrics() MetricsConfig {
+	return MetricsConfig{
+		Host: l.getString("METRICS_HOST", "0.0.0.0"),
+		Port: l.getInt("METRICS_PORT", 2222),
 	}
+}
 
-	return defaultVal
+func (l *loader) loadShutdown() ShutdownConfig {
+	return ShutdownConfig{
+		PreStopDelay: l.getDuration("SHUTDOWN_PRE_STOP_DELAY", 0),
+		DrainTimeout: l.getDuration("SHUTDOWN_DRAIN_TIMEOUT", 15*time.Second),
+		Timeout:      l.getDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+	}
 }
 
-// Helper to read an environment variable into a bool or return default value
-func getEnvAsBool(name string, defaultVal bool) bool {
-	valStr := getEnvAsString(name, "")
-	if val, err := strconv.ParseBool(valStr); err == nil {
-		return val
+func (l *loader) loadSMTP() SMTPConfig {
+	return SMTPConfig{
+		Host:     l.getString("SMTP_HOST", ""),
+		Port:     l.getInt("SMTP_PORT", 587),
+		Username: l.getString("SMTP_USERNAME", ""),
+		Password: l.getSecret("SMTP_PASSWORD"),
+		From:     l.getString("SMTP_FROM", ""),
 	}
+}
 
-	return defaultVal
+func (l *loader) loadAlerting() AlertingConfig {
+	return AlertingConfig{
+		RulesFile:          l.getString("ALERT_RULES_FILE", ""),
+		EvaluationInterval: l.getDuration("ALERT_EVALUATION_INTERVAL", time.Minute),
+		RepeatInterval:     l.getDuration("ALERT_REPEAT_INTERVAL", 0),
+		Log:                l.getBool("ALERT_LOG", true),
+		// webhook URLs often embed a token
+		WebhookURL: l.getSecret("ALERT_WEBHOOK_URL"),
+		EmailTo:    l.getStringSlice("ALERT_EMAIL_TO", nil),
+	}
 }
 
-// Helper to read a comma-separated environment variable into a slice of strings
-func getEnvAsStringSliceRequired(name string) []string {
-	valStr := getEnvAsString(name, "")
-	if valStr == "" {
-		slog.Error("Missing required environment variable", "envVar", name)
-		panic("Missing required environment variable")
+func (l *loader) loadDigest() DigestConfig {
+	return DigestConfig{
+		Schedule:     l.getString("DIGEST_SCHEDULE", ""),
+		Time:         l.getString("DIGEST_TIME", "08:00"),
+		Weekday:      l.getString("DIGEST_WEEKDAY", "monday"),
+		EmailTo:      l.getStringSlice("DIGEST_EMAIL_TO", nil),
+		Comments:     l.getInt("DIGEST_COMMENTS", 10),
+		TemplateFile: l.getString("DIGEST_TEMPLATE_FILE", ""),
 	}
-	return strings.Split(valStr, ",")
 }
 
-// Helper to read a comma-separated environment variable into a slice of strings
-func getEnvAsStringSlice(name string, defaultVal []string) []string {
-	valStr := getEnvAsString(name, "")
-	if valStr != "" {
-		return strings.Split(valStr, ",")
+func (l *loader) loadOIDC() OIDCConfig {
+	return OIDCConfig{
+		IssuerURL:    l.getString("OIDC_ISSUER_URL", ""),
+		DiscoveryURL: l.getString("OIDC_DISCOVERY_URL", ""),
+		ClientID:     l.getString("OIDC_CLIENT_ID", ""),
+		ClientSecret: l.getSecret("OIDC_CLIENT_SECRET"),
+		RedirectURL:  l.getString("OIDC_REDIRECT_URL", ""),
+		Scopes:       l.getStringSlice("OIDC_SCOPES", []string{"openid", "profile", "email"}),
+		RolesClaim:   l.getString("OIDC_ROLES_CLAIM", "groups"),
+		RoleMapping:  l.getStringSlice("OIDC_ROLE_MAPPING", nil),
 	}
-	return defaultVal
 }
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes a config file to a temporary directory, returning its path
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		wantErrs []string
+	}{
+		{name: "env only", env: map[string]string{"ISSUE_TYPES": "bug"}},
+		{name: "file only", file: "issue_types: [bug, idea]\n"},
+		{name: "missing issue types", wantErrs: []string{"ISSUE_TYPES is required"}},
+		{name: "api mode without issue types", env: map[string]string{"ISSUE_TYPES_MODE": "api"}},
+		{
+			name:     "all errors at once",
+			file:     "issue_types: bug\napi:\n  listen_port: 80x\n  batch_max_items: 0\n",
+			env:      map[string]string{"METRICS_PORT": "70000"},
+			wantErrs: []string{`API_LISTEN_PORT ("api.listen_port" in`, "API_BATCH_MAX_ITEMS must be positive", "METRICS_PORT: port 70000 is out of range"},
+		},
+		{
+			name:     "env overrides an invalid file value",
+			file:     "issue_types: bug\napi:\n  listen_port: 80x\n",
+			env:      map[string]string{"API_LISTEN_PORT": "8080"},
+			wantErrs: nil,
+		},
+		{name: "unknown file key", file: "issue_types: bug\napi:\n  listen_prot: 8080\n", wantErrs: []string{`unknown key "api.listen_prot"`}},
+		{
+			name:     "admin UI without session secret",
+			env:      map[string]string{"ISSUE_TYPES": "bug", "API_ADMIN_UI_ENABLED": "true"},
+			wantErrs: []string{"API_ADMIN_UI_SESSION_SECRET is required when API_ADMIN_UI_ENABLED is set"},
+		},
+		{name: "admin UI with session secret", env: map[string]string{"ISSUE_TYPES": "bug", "API_ADMIN_UI_ENABLED": "true", "API_ADMIN_UI_SESSION_SECRET": "s3cret"}},
+		{
+			name:     "digest without SMTP",
+			env:      map[string]string{"ISSUE_TYPES": "bug", "DIGEST_SCHEDULE": "daily"},
+			wantErrs: []string{"DIGEST_EMAIL_TO is required", "SMTP_HOST and SMTP_FROM are required when DIGEST_SCHEDULE is set"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(FileEnvVar, "")
+			if tt.file != "" {
+				t.Setenv(FileEnvVar, writeConfigFile(t, "config.yaml", tt.file))
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			_, _, err := Load()
+			checkErrors(t, err, tt.wantErrs)
+		})
+	}
+}
+
+// checkErrors checks that err has as many Errors as wantErrs, each containing the respective text
+func checkErrors(t *testing.T, err error, wantErrs []string) {
+	t.Helper()
+	var errs Errors
+	if err != nil && !errors.As(err, &errs) {
+		t.Fatalf("got error %v, want Errors", err)
+	}
+	if len(errs) != len(wantErrs) {
+		t.Fatalf("got errors %v, want %d errors", errs, len(wantErrs))
+	}
+	for i, want := range wantErrs {
+		if !strings.Contains(errs[i].Error(), want) {
+			t.Errorf("got error %q, want it to contain %q", errs[i], want)
+		}
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	t.Setenv(FileEnvVar, writeConfigFile(t, "config.toml", "issue_types = [\"bug\"]\n[api]\nlisten_port = 8080\nlisten_host = \"127.0.0.1\"\n"))
+	t.Setenv("API_LISTEN_PORT", "9090")
+	t.Setenv("POSTGRES_PASSWORD", "s3cret")
+
+	conf, values, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.API.Port != 9090 || conf.API.Host != "127.0.0.1" || conf.Metrics.Port != 2222 {
+		t.Errorf("got API %s:%d and metrics port %d", conf.API.Host, conf.API.Port, conf.Metrics.Port)
+	}
+
+	want := []Value{
+		{Name: "API_LISTEN_HOST", Value: "127.0.0.1", Source: SourceFile},
+		{Name: "API_LISTEN_PORT", Value: "9090", Source: SourceEnv},
+		{Name: "METRICS_PORT", Value: "2222", Source: SourceDefault},
+		{Name: "POSTGRES_PASSWORD", Value: "s3cret", Source: SourceEnv, Secret: true},
+	}
+	for _, w := range want {
+		if !slices.Contains(values, w) {
+			t.Errorf("got no value %+v", w)
+		}
+	}
+}
+
+func TestLoadDatabase(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "other settings invalid", env: map[string]string{"POSTGRES_HOST": "db", "API_LISTEN_PORT": "80x"}},
+		{name: "invalid port", env: map[string]string{"POSTGRES_PORT": "5432x"}, wantErr: true},
+		{name: "port out of range", env: map[string]string{"POSTGRES_PORT": "0"}, wantErr: true},
+		{name: "TLS", env: map[string]string{"POSTGRES_SSLMODE": "verify-full", "POSTGRES_SSLCERT": "/tls.crt", "POSTGRES_SSLKEY": "/tls.key"}},
+		{name: "invalid sslmode", env: map[string]string{"POSTGRES_SSLMODE": "on"}, wantErr: true},
+		{name: "client certificate without key", env: map[string]string{"POSTGRES_SSLCERT": "/tls.crt"}, wantErr: true},
+		{name: "negative pool size", env: map[string]string{"POSTGRES_MAX_OPEN_CONNS": "-1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(FileEnvVar, "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			if _, err := LoadDatabase(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// fileValue is a config file value, flattened to the string its environment variable would have
+type fileValue struct {
+	// dotted key in the file, for errors
+	key   string
+	value string
+}
+
+// readFile reads a YAML (.yaml, .yml) or TOML (.toml) config file. Its keys are the environment variable names
+// in lower case, with nested keys joined by underscores, so that e.g. postgres.host sets POSTGRES_HOST.
+// Lists are joined by commas.
+func readFile(path string) (map[string]fileValue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var content map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &content)
+	case ".toml":
+		err = toml.Unmarshal(data, &content)
+	default:
+		return nil, fmt.Errorf("config file %s must have a .yaml, .yml or .toml extension", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := map[string]fileValue{}
+	if err := flatten(nil, content, values); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flatten(path []string, content map[string]any, values map[string]fileValue) error {
+	for _, k := range sortedKeys(content) {
+		keyPath := append(slices.Clone(path), k)
+		key := strings.Join(keyPath, ".")
+
+		var value string
+		switch v := content[k].(type) {
+		case nil:
+			continue
+		case map[string]any:
+			if err := flatten(keyPath, v, values); err != nil {
+				return err
+			}
+			continue
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				s, ok := scalarString(item)
+				if !ok {
+					return fmt.Errorf("%q must be a list of strings, numbers or booleans", key)
+				}
+				items[i] = s
+			}
+			value = strings.Join(items, ",")
+		default:
+			s, ok := scalarString(v)
+			if !ok {
+				return fmt.Errorf("%q has an unsupported type %T", key, v)
+			}
+			value = s
+		}
+
+		name := strings.ToUpper(strings.Join(keyPath, "_"))
+		if previous, ok := values[name]; ok {
+			return fmt.Errorf("%q and %q both set %s", previous.key, key, name)
+		}
+		values[name] = fileValue{key: key, value: value}
+	}
+	return nil
+}
+
+func scalarString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), true
+	// unquoted timestamps are parsed as such by both formats
+	case time.Time:
+		return v.Format(time.RFC3339), true
+	}
+	return "", false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
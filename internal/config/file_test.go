@@ -0,0 +1,55 @@
+package config
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "YAML",
+			file:    "config.yaml",
+			content: "issue_types: [bug, idea]\napi:\n  listen_port: 8080\n  debug_mode: true\n  legacy_routes_sunset: 2027-04-01T00:00:00Z\npostgres:\n  host: db\n  user: ~\n",
+			want: map[string]string{
+				"ISSUE_TYPES":              "bug,idea",
+				"API_LISTEN_PORT":          "8080",
+				"API_DEBUG_MODE":           "true",
+				"API_LEGACY_ROUTES_SUNSET": "2027-04-01T00:00:00Z",
+				"POSTGRES_HOST":            "db",
+			},
+		},
+		{
+			name:    "TOML",
+			file:    "config.toml",
+			content: "issue_types = [\"bug\"]\n[postgres]\nhost = \"db\"\nport = 5433\n",
+			want:    map[string]string{"ISSUE_TYPES": "bug", "POSTGRES_HOST": "db", "POSTGRES_PORT": "5433"},
+		},
+		{name: "flat and nested keys", file: "config.yml", content: "postgres_host: a\npostgres:\n  host: b\n", wantErr: true},
+		{name: "list of maps", file: "config.yaml", content: "issue_types:\n  - name: bug\n", wantErr: true},
+		{name: "invalid syntax", file: "config.yaml", content: "api: [\n", wantErr: true},
+		{name: "unsupported extension", file: "config.json", content: "{}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := readFile(writeConfigFile(t, tt.file, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			got := map[string]string{}
+			for name, v := range values {
+				got[name] = v.value
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileEnvVar is the environment variable with the path of the YAML or TOML config file
+const FileEnvVar = "CONFIG_FILE"
+
+// Where a value was set, in increasing order of precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	// read from the file named by <name>_FILE, e.g. a mounted Kubernetes secret
+	SourceSecretFile = "secret file"
+)
+
+// secretFileSuffix is appended to the names of secrets to read them from a file instead
+const secretFileSuffix = "_FILE"
+
+// Value is a resolved configuration value, named by its environment variable
+type Value struct {
+	Name   string
+	Value  string
+	Source string
+	// passwords, tokens and other values which shouldn't be printed
+	Secret bool
+	// path of the secret file the value was read from
+	File string
+}
+
+// Errors are all the problems found in a configuration
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// loader resolves values from the config file and environment variables, collecting errors instead of stopping at the first one
+type loader struct {
+	file     map[string]fileValue
+	filePath string
+	// file keys which were read, all others are unknown
+	read   map[string]bool
+	values []Value
+	errs   Errors
+}
+
+func newLoader(filePath string) *loader {
+	l := &loader{filePath: filePath, read: map[string]bool{}}
+	if filePath != "" {
+		file, err := readFile(filePath)
+		if err != nil {
+			l.errs = append(l.errs, err)
+		}
+		l.file = file
+	}
+	return l
+}
+
+// lookup returns the value of a variable and whether it was set, recording it for printing.
+// Secrets may also be read from the file named by <name>_FILE.
+func (l *loader) lookup(name string, defaultVal string, secret bool) (string, bool) {
+	value, source := l.raw(name)
+	if source == SourceDefault {
+		value = defaultVal
+	}
+	v := Value{Name: name, Value: value, Source: source, Secret: secret}
+
+	if secret {
+		if path, pathSource := l.raw(name + secretFileSuffix); pathSource != SourceDefault && path != "" {
+			if source != SourceDefault {
+				l.errs = append(l.errs, fmt.Errorf("%s and %s%s are both set, only one may be", l.describe(name), name, secretFileSuffix))
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				l.errs = append(l.errs, fmt.Errorf("%s%s: failed to read secret: %w", name, secretFileSuffix, err))
+			}
+			// files written by editors and "echo" end with a newline, which isn't part of the secret
+			v.Value, v.Source, v.File = strings.TrimRight(string(content), "\r\n"), SourceSecretFile, path
+		}
+	}
+
+	l.values = append(l.values, v)
+	return v.Value, v.Source != SourceDefault
+}
+
+// raw returns the value of a variable in the environment or the config file, and where it was found
+func (l *loader) raw(name string) (string, string) {
+	if v, ok := os.LookupEnv(name); ok {
+		if _, ok := l.file[name]; ok {
+			l.read[name] = true
+		}
+		return v, SourceEnv
+	}
+	if v, ok := l.file[name]; ok {
+		l.read[name] = true
+		return v.value, SourceFile
+	}
+	return "", SourceDefault
+}
+
+// invalid records a value which couldn't be parsed
+func (l *loader) invalid(name string, value string, expected string) {
+	l.errs = append(l.errs, fmt.Errorf("%s: invalid value %q, expected %s", l.describe(name), value, expected))
+}
+
+// describe names a variable along with where it was set, so that errors point to the right place
+func (l *loader) describe(name string) string {
+	if _, ok := os.LookupEnv(name); ok {
+		return name
+	}
+	if v, ok := l.file[name]; ok {
+		return fmt.Sprintf("%s (%q in %s)", name, v.key, l.filePath)
+	}
+	return name
+}
+
+func (l *loader) getString(name string, defaultVal string) string {
+	value, _ := l.lookup(name, defaultVal, false)
+	return value
+}
+
+func (l *loader) getSecret(name string) string {
+	value, _ := l.lookup(name, "", true)
+	return value
+}
+
+// Typed values which are set but empty fall back to the default, as with unset ones
+
+func (l *loader) getInt(name string, defaultVal int) int {
+	valueStr, _ := l.lookup(name, strconv.Itoa(defaultVal), false)
+	if valueStr == "" {
+		return defaultVal
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		l.invalid(name, valueStr, "an integer")
+		return defaultVal
+	}
+	return value
+}
+
+func (l *loader) getBool(name string, defaultVal bool) bool {
+	valueStr, _ := l.lookup(name, strconv.FormatBool(defaultVal), false)
+	if valueStr == "" {
+		return defaultVal
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		l.invalid(name, valueStr, "true or false")
+		return defaultVal
+	}
+	return value
+}
+
+func (l *loader) getFloat(name string, defaultVal float64) float64 {
+	valueStr, _ := l.lookup(name, strconv.FormatFloat(defaultVal, 'g', -1, 64), false)
+	if valueStr == "" {
+		return defaultVal
+	}
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		l.invalid(name, valueStr, "a number")
+		return defaultVal
+	}
+	return value
+}
+
+// getDuration reads a duration such as "90s" or "72h"
+func (l *loader) getDuration(name string, defaultVal time.Duration) time.Duration {
+	valueStr, _ := l.lookup(name, defaultVal.String(), false)
+	if valueStr == "" {
+		return defaultVal
+	}
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		l.invalid(name, valueStr, `a duration such as "90s" or "72h"`)
+		return defaultVal
+	}
+	return value
+}
+
+// getTime reads an RFC3339 timestamp
+func (l *loader) getTime(name string, defaultVal time.Time) time.Time {
+	defaultStr := ""
+	if !defaultVal.IsZero() {
+		defaultStr = defaultVal.Format(time.RFC3339)
+	}
+	valueStr, _ := l.lookup(name, defaultStr, false)
+	if valueStr == "" {
+		return defaultVal
+	}
+	value, err := time.Parse(time.RFC3339, valueStr)
+	if err != nil {
+		l.invalid(name, valueStr, "an RFC3339 timestamp")
+		return defaultVal
+	}
+	return value
+}
+
+// getStringSlice reads a comma-separated list, which may also be a list in the config file
+func (l *loader) getStringSlice(name string, defaultVal []string) []string {
+	valueStr, _ := l.lookup(name, strings.Join(defaultVal, ","), false)
+	if valueStr == "" {
+		return defaultVal
+	}
+	return strings.Split(valueStr, ",")
+}
+
+// getSubmitTokens reads comma-separated "<label>=<token>[@<RFC3339 expiry>]" submit tokens,
+// along with a single token without a label or expiry, which is labelled "default"
+func (l *loader) getSubmitTokens(name string, singleName string) []SubmitToken {
+	var tokens []SubmitToken
+	if token, _ := l.lookup(singleName, "", true); token != "" {
+		tokens = append(tokens, SubmitToken{Label: "default", Token: token})
+	}
+
+	entries, _ := l.lookup(name, "", true)
+	if entries == "" {
+		return tokens
+	}
+	for _, entry := range splitEntries(entries) {
+		label, rest, ok := strings.Cut(entry, "=")
+		token, expiry, hasExpiry := strings.Cut(rest, "@")
+		var expiresAt time.Time
+		var err error
+		if hasExpiry {
+			expiresAt, err = time.Parse(time.RFC3339, expiry)
+		}
+		if !ok || label == "" || token == "" || err != nil {
+			// the token itself isn't included, it's a secret
+			l.errs = append(l.errs, fmt.Errorf("%s: invalid submit token labelled %q, expected <label>=<token>[@<RFC3339 expiry>]", l.describe(name), label))
+			continue
+		}
+		duplicate := false
+		for _, t := range tokens {
+			duplicate = duplicate || t.Label == label
+		}
+		if duplicate {
+			l.errs = append(l.errs, fmt.Errorf("%s: duplicate submit token label %q", l.describe(name), label))
+			continue
+		}
+		tokens = append(tokens, SubmitToken{Label: label, Token: token, ExpiresAt: expiresAt})
+	}
+	return tokens
+}
+
+// getSigningClients reads comma-separated "<client ID>=<secret>" signing keys
+func (l *loader) getSigningClients(name string) []SigningClient {
+	entries, _ := l.lookup(name, "", true)
+	if entries == "" {
+		return nil
+	}
+	var clients []SigningClient
+	for _, entry := range splitEntries(entries) {
+		id, secret, ok := strings.Cut(entry, "=")
+		if !ok || id == "" || len(secret) < 32 {
+			l.errs = append(l.errs, fmt.Errorf("%s: invalid signing key of client %q, expected <client ID>=<secret of at least 32 characters>", l.describe(name), id))
+			continue
+		}
+		clients = append(clients, SigningClient{ID: id, Secret: secret})
+	}
+	return clients
+}
+
+// getHeaders reads comma-separated "<name>=<value>" HTTP headers, which are secret as they may contain credentials
+func (l *loader) getHeaders(name string) map[string]string {
+	entries, _ := l.lookup(name, "", true)
+	if entries == "" {
+		return nil
+	}
+	headers := map[string]string{}
+	for _, entry := range splitEntries(entries) {
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			// the entry itself isn't included, it may be a credential
+			l.errs = append(l.errs, fmt.Errorf("%s: invalid header, expected <name>=<value>", l.describe(name)))
+			continue
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+// checkUnknownFileKeys reports config file keys which aren't read, most likely typos
+func (l *loader) checkUnknownFileKeys() {
+	for _, name := range sortedKeys(l.file) {
+		if !l.read[name] {
+			l.errs = append(l.errs, fmt.Errorf("unknown key %q in %s", l.file[name].key, l.filePath))
+		}
+	}
+}
+
+// splitEntries splits a list of secrets separated by commas, or by lines in a secret file
+func splitEntries(s string) []string {
+	var entries []string
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoaderTypedValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		get     func(l *loader) any
+		want    any
+		wantErr bool
+	}{
+		{"int", "8080", func(l *loader) any { return l.getInt("TEST_VALUE", 80) }, 8080, false},
+		{"invalid int", "80x", func(l *loader) any { return l.getInt("TEST_VALUE", 80) }, 80, true},
+		{"empty int", "", func(l *loader) any { return l.getInt("TEST_VALUE", 80) }, 80, false},
+		{"bool", "true", func(l *loader) any { return l.getBool("TEST_VALUE", false) }, true, false},
+		{"invalid bool", "yes", func(l *loader) any { return l.getBool("TEST_VALUE", false) }, false, true},
+		{"duration", "90s", func(l *loader) any { return l.getDuration("TEST_VALUE", time.Minute) }, 90 * time.Second, false},
+		{"invalid duration", "90", func(l *loader) any { return l.getDuration("TEST_VALUE", time.Minute) }, time.Minute, true},
+		{
+			"time", "2027-04-01T12:00:00Z",
+			func(l *loader) any { return l.getTime("TEST_VALUE", time.Time{}) },
+			time.Date(2027, time.April, 1, 12, 0, 0, 0, time.UTC), false,
+		},
+		{"invalid time", "2027-04-01", func(l *loader) any { return l.getTime("TEST_VALUE", time.Time{}) }, time.Time{}, true},
+		{"empty string", "", func(l *loader) any { return l.getString("TEST_VALUE", "default") }, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_VALUE", tt.value)
+			l := newLoader("")
+			if got := tt.get(l); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if (len(l.errs) > 0) != tt.wantErr {
+				t.Errorf("got errors %v, want errors: %v", l.errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoaderSubmitTokens(t *testing.T) {
+	expiry := time.Date(2026, time.November, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		tokens  string
+		single  string
+		want    []SubmitToken
+		wantErr bool
+	}{
+		{name: "none", want: nil},
+		{name: "single token", single: "s3cret", want: []SubmitToken{{Label: "default", Token: "s3cret"}}},
+		{
+			name:   "labelled tokens",
+			tokens: "2026-10=abc@2026-11-15T00:00:00Z, 2026-11=def",
+			want:   []SubmitToken{{Label: "2026-10", Token: "abc", ExpiresAt: expiry}, {Label: "2026-11", Token: "def"}},
+		},
+		{
+			name:   "single and labelled tokens",
+			tokens: "2026-11=def",
+			single: "s3cret",
+			want:   []SubmitToken{{Label: "default", Token: "s3cret"}, {Label: "2026-11", Token: "def"}},
+		},
+		{name: "without label", tokens: "abc", wantErr: true},
+		{name: "empty label", tokens: "=abc", wantErr: true},
+		{name: "empty token", tokens: "2026-10=", wantErr: true},
+		{name: "invalid expiry", tokens: "2026-10=abc@2026-11-15", wantErr: true},
+		{name: "duplicate label", tokens: "2026-10=abc,2026-10=def", want: []SubmitToken{{Label: "2026-10", Token: "abc"}}, wantErr: true},
+		{name: "duplicate default label", tokens: "default=abc", single: "s3cret", want: []SubmitToken{{Label: "default", Token: "s3cret"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_SUBMIT_TOKENS", tt.tokens)
+			t.Setenv("API_SUBMIT_TOKEN", tt.single)
+			l := newLoader("")
+
+			got := l.getSubmitTokens("API_SUBMIT_TOKENS", "API_SUBMIT_TOKEN")
+			if !slices.EqualFunc(got, tt.want, func(a, b SubmitToken) bool {
+				return a.Label == b.Label && a.Token == b.Token && a.ExpiresAt.Equal(b.ExpiresAt)
+			}) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if (len(l.errs) > 0) != tt.wantErr {
+				t.Errorf("got errors %v, want errors: %v", l.errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoaderSigningClients(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name    string
+		keys    string
+		want    []SigningClient
+		wantErr bool
+	}{
+		{name: "none", want: nil},
+		{name: "one client", keys: "billing=" + secret, want: []SigningClient{{ID: "billing", Secret: secret}}},
+		{
+			name: "rotated key",
+			keys: "billing=" + secret + ", billing=x" + secret,
+			want: []SigningClient{{ID: "billing", Secret: secret}, {ID: "billing", Secret: "x" + secret}},
+		},
+		{name: "short secret", keys: "billing=" + secret[1:], wantErr: true},
+		{name: "without client", keys: "=" + secret, wantErr: true},
+		{name: "without separator", keys: secret, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_SUBMIT_SIGNING_KEYS", tt.keys)
+			l := newLoader("")
+
+			if got := l.getSigningClients("API_SUBMIT_SIGNING_KEYS"); !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if (len(l.errs) > 0) != tt.wantErr {
+				t.Errorf("got errors %v, want errors: %v", l.errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoaderSecretFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		content string
+		noFile  bool
+		want    string
+		wantErr bool
+	}{
+		{name: "secret file", content: "s3cret", want: "s3cret"},
+		{name: "trailing newline", content: "s3cret\r\n", want: "s3cret"},
+		{name: "both set", env: "other", content: "s3cret", want: "s3cret", wantErr: true},
+		{name: "missing file", noFile: true, want: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "SMTP_PASSWORD")
+			if !tt.noFile {
+				if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.env != "" {
+				t.Setenv("SMTP_PASSWORD", tt.env)
+			}
+			t.Setenv("SMTP_PASSWORD_FILE", path)
+			l := newLoader("")
+
+			if got := l.getSecret("SMTP_PASSWORD"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if (len(l.errs) > 0) != tt.wantErr {
+				t.Errorf("got errors %v, want errors: %v", l.errs, tt.wantErr)
+			}
+			if v := l.values[len(l.values)-1]; v.Source != SourceSecretFile || v.File != path {
+				t.Errorf("got source %q of file %q", v.Source, v.File)
+			}
+		})
+	}
+}
+
+func TestSplitEntries(t *testing.T) {
+	got := splitEntries("a=1, b=2\nc=3\n\n")
+	if want := []string{"a=1", "b=2", "c=3"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
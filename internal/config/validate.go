@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Propagators are the supported trace context formats
+var Propagators = []string{"tracecontext", "baggage", "b3", "b3multi", "jaeger", "none"}
+
+// checker collects the errors of failed checks
+type checker struct {
+	errs Errors
+}
+
+func (v *checker) check(ok bool, format string, args ...any) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf(format, args...))
+	}
+}
+
+func (v *checker) checkPort(name string, port int) {
+	v.check(port > 0 && port <= 65535, "%s: port %d is out of range", name, port)
+}
+
+// checkInterval checks durations used as ticker intervals, which must be positive
+func (v *checker) checkInterval(name string, interval time.Duration) {
+	v.check(interval > 0, "%s must be positive", name)
+}
+
+// validate checks values which parsed but can't work, e.g. ports out of range or settings missing what they depend on
+func (c *Config) validate() Errors {
+	var v checker
+	v.check(c.WatchInterval >= 0, "CONFIG_WATCH_INTERVAL must not be negative")
+	c.validateAPI(&v)
+	c.validateDatabase(&v)
+	c.validateTracing(&v)
+	c.validateMetrics(&v)
+	c.validateShutdown(&v)
+	c.validateNotifications(&v)
+	c.validateOIDC(&v)
+	return v.errs
+}
+
+func (c *Config) validateAPI(v *checker) {
+	switch c.API.IssueTypesMode {
+	case "env":
+		v.check(len(c.IssueTypes) > 0, `ISSUE_TYPES is required when ISSUE_TYPES_MODE is "env"`)
+	case "api":
+	default:
+		v.check(false, `ISSUE_TYPES_MODE: invalid value %q, expected "env" or "api"`, c.API.IssueTypesMode)
+	}
+
+	v.checkPort("API_LISTEN_PORT", c.API.Port)
+	v.checkInterval("API_SUBMIT_SIGNATURE_WINDOW", c.API.SubmitSignatureWindow)
+	v.checkInterval("API_IDEMPOTENCY_KEY_TTL", c.API.IdempotencyKeyTTL)
+	v.checkInterval("API_STREAM_KEEPALIVE_INTERVAL", c.API.StreamKeepAlive)
+	v.checkInterval("API_ADMIN_UI_SESSION_TTL", c.API.AdminUISessionTTL)
+	v.check(c.API.BatchMaxTimestampSkew >= 0, "API_BATCH_MAX_TIMESTAMP_SKEW must not be negative")
+	v.check(c.API.BatchMaxItems > 0, "API_BATCH_MAX_ITEMS must be positive")
+	v.check(c.API.ReadinessTimeout > 0, "API_READINESS_TIMEOUT must be positive")
+	if c.API.AdminUIEnabled {
+		v.check(c.API.AdminUISessionSecret != "", "API_ADMIN_UI_SESSION_SECRET is required when API_ADMIN_UI_ENABLED is set")
+	}
+}
+
+func (c *Config) validateDatabase(v *checker) {
+	v.checkPort("POSTGRES_PORT", c.Database.Port)
+	if !slices.Contains([]string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}, c.Database.SSLMode) {
+		v.check(false, `POSTGRES_SSLMODE: invalid value %q, expected "disable", "allow", "prefer", "require", "verify-ca" or "verify-full"`, c.Database.SSLMode)
+	}
+	v.check((c.Database.SSLCert == "") == (c.Database.SSLKey == ""), "POSTGRES_SSLCERT and POSTGRES_SSLKEY must be set together")
+	v.check(c.Database.StatementTimeout >= 0, "POSTGRES_STATEMENT_TIMEOUT must not be negative")
+	v.check(c.Database.MaxOpenConns >= 0, "POSTGRES_MAX_OPEN_CONNS must not be negative")
+	v.check(c.Database.MaxIdleConns >= 0, "POSTGRES_MAX_IDLE_CONNS must not be negative")
+	v.check(c.Database.ConnMaxLifetime >= 0, "POSTGRES_CONN_MAX_LIFETIME must not be negative")
+	v.check(c.Database.ConnMaxIdleTime >= 0, "POSTGRES_CONN_MAX_IDLE_TIME must not be negative")
+	v.check(c.Database.StartupMaxWait >= 0, "POSTGRES_STARTUP_MAX_WAIT must not be negative")
+}
+
+func (c *Config) validateTracing(v *checker) {
+	v.checkPort("OTLP_GRPC_PORT", c.Tracing.Port)
+	v.checkPort("OTLP_HTTP_PORT", c.Tracing.HTTPPort)
+	if c.Tracing.Protocol != "grpc" && c.Tracing.Protocol != "http" {
+		v.check(false, `OTLP_PROTOCOL: invalid value %q, expected "grpc" or "http"`, c.Tracing.Protocol)
+	}
+	v.check((c.Tracing.TLSCertFile == "") == (c.Tracing.TLSKeyFile == ""), "OTLP_TLS_CERT_FILE and OTLP_TLS_KEY_FILE must be set together")
+	for _, propagator := range c.Tracing.Propagators {
+		if !slices.Contains(Propagators, propagator) {
+			v.check(false, `OTLP_PROPAGATORS: invalid propagator %q, expected "%s"`, propagator, strings.Join(Propagators, `", "`))
+		}
+	}
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "OTLP_SAMPLE_RATIO must be between 0 and 1")
+}
+
+func (c *Config) validateMetrics(v *checker) {
+	v.checkPort("METRICS_PORT", c.Metrics.Port)
+	v.check(c.API.Port != c.Metrics.Port || c.API.Host != c.Metrics.Host, "API_LISTEN_PORT and METRICS_PORT can't both be %d", c.API.Port)
+}
+
+func (c *Config) validateShutdown(v *checker) {
+	v.check(c.Shutdown.PreStopDelay >= 0, "SHUTDOWN_PRE_STOP_DELAY must not be negative")
+	v.check(c.Shutdown.DrainTimeout > 0, "SHUTDOWN_DRAIN_TIMEOUT must be positive")
+	v.check(c.Shutdown.Timeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+}
+
+// validateNotifications checks SMTP along with the alerting and digest settings depending on it
+func (c *Config) validateNotifications(v *checker) {
+	v.checkPort("SMTP_PORT", c.SMTP.Port)
+	v.checkInterval("ALERT_EVALUATION_INTERVAL", c.Alerting.EvaluationInterval)
+	v.check(c.Alerting.RepeatInterval >= 0, "ALERT_REPEAT_INTERVAL must not be negative")
+	v.check(c.Digest.Comments >= 0, "DIGEST_COMMENTS must not be negative")
+
+	smtpConfigured := c.SMTP.Host != "" && c.SMTP.From != ""
+	if c.Digest.Schedule != "" {
+		v.check(len(c.Digest.EmailTo) > 0, "DIGEST_EMAIL_TO is required when DIGEST_SCHEDULE is set")
+		v.check(smtpConfigured, "SMTP_HOST and SMTP_FROM are required when DIGEST_SCHEDULE is set")
+	}
+	if c.Alerting.RulesFile != "" && len(c.Alerting.EmailTo) > 0 {
+		v.check(smtpConfigured, "SMTP_HOST and SMTP_FROM are required when ALERT_EMAIL_TO is set")
+	}
+}
+
+func (c *Config) validateOIDC(v *checker) {
+	if c.OIDC.IssuerURL == "" {
+		return
+	}
+	v.check(c.OIDC.ClientID != "", "OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set")
+	v.check(c.OIDC.RedirectURL != "", "OIDC_REDIRECT_URL is required when OIDC_ISSUER_URL is set")
+	v.check(len(c.OIDC.RoleMapping) > 0, "OIDC_ROLE_MAPPING is required when OIDC_ISSUER_URL is set")
+}
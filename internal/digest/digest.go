@@ -0,0 +1,156 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/reports"
+	"gorm.io/gorm"
+)
+
+//go:embed templates/digest.html.tmpl
+var templates embed.FS
+
+const maxTopIssues = 5
+
+// Digest summarizes the reports created within a period
+type Digest struct {
+	From time.Time
+	To   time.Time
+	// stats of the period and of the period before it, for comparison
+	Stats         reports.Stats
+	PreviousStats reports.Stats
+	TopIssues     []IssueStats
+	Comments      []Comment
+}
+
+type IssueStats struct {
+	Name string
+	reports.Stats
+}
+
+type Comment struct {
+	Text      string
+	Satisfied bool
+	Issue     string
+	CreatedAt time.Time
+}
+
+// RatioChange returns the change of the satisfaction ratio since the previous period
+func (d Digest) RatioChange() float64 {
+	return d.Stats.Ratio() - d.PreviousStats.Ratio()
+}
+
+// Build collects the digest of reports created within [from, to), with up to maxComments of the newest comments
+func Build(db *gorm.DB, from, to time.Time, maxComments int) (Digest, error) {
+	d := Digest{From: from, To: to}
+
+	stats, err := reports.GetStats(db, reports.Filter{From: &from, To: &to}, "")
+	if err != nil {
+		return d, err
+	}
+	d.Stats = stats[0]
+
+	previousFrom := from.Add(-to.Sub(from))
+	stats, err = reports.GetStats(db, reports.Filter{From: &previousFrom, To: &from}, "")
+	if err != nil {
+		return d, err
+	}
+	d.PreviousStats = stats[0]
+
+	// deleted issue types are included, as reports may still refer to them
+	var issues []models.Issue
+	if err := db.Unscoped().Find(&issues).Error; err != nil {
+		return d, err
+	}
+	issueNames := make(map[string]string, len(issues))
+	for _, issue := range issues {
+		issueNames[fmt.Sprint(issue.ID)] = issue.Name
+	}
+
+	byIssue, err := reports.GetStats(db, reports.Filter{From: &from, To: &to}, "issue")
+	if err != nil {
+		return d, err
+	}
+	for _, s := range byIssue {
+		// reports without an issue are usually the satisfied ones
+		if s.Group == nil {
+			continue
+		}
+		d.TopIssues = append(d.TopIssues, IssueStats{Name: issueNames[*s.Group], Stats: s})
+		if len(d.TopIssues) == maxTopIssues {
+			break
+		}
+	}
+
+	var commented []models.Report
+	err = db.Preload("Issue", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("created_at >= ? AND created_at < ? AND comment <> ''", from, to).
+		Order("created_at DESC").
+		Limit(maxComments).
+		Find(&commented).Error
+	if err != nil {
+		return d, err
+	}
+	for _, r := range commented {
+		c := Comment{Text: r.Comment, Satisfied: r.Satisfied != nil && *r.Satisfied, CreatedAt: r.CreatedAt}
+		if r.Issue != nil {
+			c.Issue = r.Issue.Name
+		}
+		d.Comments = append(d.Comments, c)
+	}
+
+	return d, nil
+}
+
+// Template renders digests into emails. It must define a "subject" and a "body" template.
+type Template struct {
+	t *template.Template
+}
+
+var funcs = template.FuncMap{
+	"percent": func(ratio float64) string { return fmt.Sprintf("%.1f%%", 100*ratio) },
+	"signedPercent": func(ratio float64) string {
+		return fmt.Sprintf("%+.1f pp", 100*ratio)
+	},
+	"date": func(t time.Time) string { return t.Format("Jan 2, 2006") },
+}
+
+// LoadTemplate parses the template file at path, or the built-in template if path is empty
+func LoadTemplate(path string) (*Template, error) {
+	t := template.New("digest").Funcs(funcs)
+	var err error
+	if path == "" {
+		t, err = t.ParseFS(templates, "templates/digest.html.tmpl")
+	} else {
+		t, err = t.ParseFiles(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"subject", "body"} {
+		if t.Lookup(name) == nil {
+			return nil, fmt.Errorf("digest template must define a %q template", name)
+		}
+	}
+	return &Template{t: t}, nil
+}
+
+// Render returns the subject and the HTML body of the digest email
+func (t *Template) Render(d Digest) (string, string, error) {
+	var subject, body bytes.Buffer
+	if err := t.t.ExecuteTemplate(&subject, "subject", d); err != nil {
+		return "", "", err
+	}
+	if err := t.t.ExecuteTemplate(&body, "body", d); err != nil {
+		return "", "", err
+	}
+	// the subject is plain text, but escaped like the HTML body
+	return html.UnescapeString(strings.Join(strings.Fields(subject.String()), " ")), body.String(), nil
+}
@@ -0,0 +1,67 @@
+package digest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/reports"
+)
+
+func TestRender(t *testing.T) {
+	tmpl, err := LoadTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := Digest{
+		From:          time.Date(2026, time.October, 12, 8, 0, 0, 0, time.UTC),
+		To:            time.Date(2026, time.October, 19, 8, 0, 0, 0, time.UTC),
+		Stats:         reports.Stats{Total: 200, Satisfied: 150},
+		PreviousStats: reports.Stats{Total: 100, Satisfied: 80},
+		Comments:      []Comment{{Text: "<script>alert(1)</script> & co", Satisfied: false}},
+	}
+
+	subject, body, err := tmpl.Render(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Feedback digest Oct 12, 2026 – Oct 19, 2026: 75.0% satisfied (200 reports)"; subject != want {
+		t.Errorf("got subject %q, want %q", subject, want)
+	}
+	for _, want := range []string{"-5.0 pp", "&lt;script&gt;alert(1)&lt;/script&gt; &amp; co"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body doesn't contain %q", want)
+		}
+	}
+	if strings.Contains(body, "<script>") {
+		t.Error("comment is not escaped")
+	}
+}
+
+func TestLoadTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  bool
+	}{
+		{"custom", `{{define "subject"}}Digest{{end}}{{define "body"}}{{.Stats.Total}}{{end}}`, false},
+		{"no subject", `{{define "body"}}{{.Stats.Total}}{{end}}`, true},
+		{"no body", `{{define "subject"}}Digest{{end}}`, true},
+		{"syntax error", `{{define "subject"}}{{.Stats.Total{{end}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "digest.html.tmpl")
+			if err := os.WriteFile(path, []byte(tt.template), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadTemplate(path); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/mail"
+	"github.com/Stogas/feedback-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Mailer sends digests to a list of recipients
+type Mailer struct {
+	db          *gorm.DB
+	sender      *mail.Sender
+	template    *Template
+	schedule    Schedule
+	to          []string
+	maxComments int
+}
+
+func NewMailer(db *gorm.DB, sender *mail.Sender, template *Template, schedule Schedule, to []string, maxComments int) *Mailer {
+	return &Mailer{db: db, sender: sender, template: template, schedule: schedule, to: to, maxComments: maxComments}
+}
+
+// Recipients returns the email addresses digests are sent to
+func (m *Mailer) Recipients() []string {
+	return m.to
+}
+
+// Send sends the digest of the period ending at the given time
+func (m *Mailer) Send(ctx context.Context, to time.Time) error {
+	d, err := Build(m.db.WithContext(ctx), to.Add(-m.schedule.Period()), to, m.maxComments)
+	if err != nil {
+		return err
+	}
+	subject, body, err := m.template.Render(d)
+	if err != nil {
+		return err
+	}
+	return m.sender.Send(mail.Message{To: m.to, Subject: subject, Body: body, HTML: true})
+}
+
+// Run sends digests on schedule until the context is cancelled. Each digest is claimed
+// in the database before sending, so that only one replica sends it.
+func (m *Mailer) Run(ctx context.Context) {
+	for {
+		next := m.schedule.Next(time.Now())
+		slog.Debug("Next digest scheduled", "at", next)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		m.deliver(ctx, next)
+	}
+}
+
+// deliver sends the digest of a period, retrying failures with backoff until the next period ends
+func (m *Mailer) deliver(ctx context.Context, periodEnd time.Time) {
+	deadline := m.schedule.Next(periodEnd)
+	backoff := time.Minute
+	for {
+		err := m.claimAndSend(ctx, periodEnd)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		retryIn := min(backoff, time.Until(deadline))
+		if retryIn <= 0 {
+			slog.Error("Failed to send digest, giving up as the next one is due", "error", err, "periodEnd", periodEnd)
+			return
+		}
+		slog.Error("Failed to send digest, retrying", "error", err, "periodEnd", periodEnd, "retryIn", retryIn)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryIn):
+		}
+		backoff = min(2*backoff, time.Hour)
+	}
+}
+
+// claimAndSend sends the digest of a period unless another replica claimed it. The claim is released
+// if sending fails, so that the digest is retried, by this or another replica.
+func (m *Mailer) claimAndSend(ctx context.Context, periodEnd time.Time) error {
+	run := models.DigestRun{PeriodEnd: periodEnd}
+	err := m.db.WithContext(ctx).Create(&run).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		slog.Debug("Digest was sent by another replica", "periodEnd", periodEnd)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to claim digest: %w", err)
+	}
+
+	if err := m.Send(ctx, periodEnd); err != nil {
+		// released even if ctx was canceled by a shutdown
+		if releaseErr := m.db.WithContext(context.WithoutCancel(ctx)).Delete(&run).Error; releaseErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to release digest claim: %w", releaseErr))
+		}
+		return err
+	}
+	slog.Info("Sent digest", "periodEnd", periodEnd, "recipients", len(m.to))
+	return nil
+}
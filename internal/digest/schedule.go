@@ -0,0 +1,75 @@
+package digest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	ScheduleDaily  = "daily"
+	ScheduleWeekly = "weekly"
+)
+
+// Schedule is when digests are sent, each covering the period since the previous one
+type Schedule struct {
+	weekly  bool
+	weekday time.Weekday
+	hour    int
+	minute  int
+}
+
+// ParseSchedule parses a "daily" or "weekly" schedule, sent at a time of day ("15:04") and, if weekly, on a weekday ("monday")
+func ParseSchedule(schedule, at, weekday string) (Schedule, error) {
+	var s Schedule
+	switch schedule {
+	case ScheduleDaily:
+	case ScheduleWeekly:
+		s.weekly = true
+	default:
+		return s, fmt.Errorf("invalid digest schedule %q, expected %q or %q", schedule, ScheduleDaily, ScheduleWeekly)
+	}
+
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return s, fmt.Errorf("invalid digest time %q, expected HH:MM", at)
+	}
+	s.hour, s.minute = t.Hour(), t.Minute()
+
+	if s.weekly {
+		found := false
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(d.String(), weekday) {
+				s.weekday, found = d, true
+			}
+		}
+		if !found {
+			return s, fmt.Errorf("invalid digest weekday %q", weekday)
+		}
+	}
+	return s, nil
+}
+
+// Period returns how long a period covered by a digest is
+func (s Schedule) Period() time.Duration {
+	if s.weekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Next returns the first time a digest is due after now, in now's location
+func (s Schedule) Next(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), s.hour, s.minute, 0, 0, now.Location())
+	if s.weekly {
+		next = next.AddDate(0, 0, (int(s.weekday)-int(next.Weekday())+7)%7)
+	}
+	for !next.After(now) {
+		if s.weekly {
+			next = next.AddDate(0, 0, 7)
+		} else {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+	return next
+}
@@ -0,0 +1,65 @@
+package digest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		at       string
+		weekday  string
+		wantErr  bool
+	}{
+		{"daily", ScheduleDaily, "08:00", "", false},
+		{"weekly", ScheduleWeekly, "17:30", "Friday", false},
+		{"unknown schedule", "monthly", "08:00", "", true},
+		{"invalid time", ScheduleDaily, "8am", "", true},
+		{"out of range time", ScheduleDaily, "24:00", "", true},
+		{"invalid weekday", ScheduleWeekly, "08:00", "someday", true},
+		{"weekday ignored when daily", ScheduleDaily, "08:00", "someday", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSchedule(tt.schedule, tt.at, tt.weekday); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2026, time.October, 21, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule string
+		at       string
+		weekday  string
+		want     time.Time
+	}{
+		{"daily later today", ScheduleDaily, "17:00", "", time.Date(2026, time.October, 21, 17, 0, 0, 0, time.UTC)},
+		{"daily due now", ScheduleDaily, "09:00", "", time.Date(2026, time.October, 22, 9, 0, 0, 0, time.UTC)},
+		{"daily tomorrow", ScheduleDaily, "08:00", "", time.Date(2026, time.October, 22, 8, 0, 0, 0, time.UTC)},
+		{"weekly this week", ScheduleWeekly, "08:00", "friday", time.Date(2026, time.October, 23, 8, 0, 0, 0, time.UTC)},
+		{"weekly later today", ScheduleWeekly, "10:00", "wednesday", time.Date(2026, time.October, 21, 10, 0, 0, 0, time.UTC)},
+		{"weekly next week", ScheduleWeekly, "08:00", "wednesday", time.Date(2026, time.October, 28, 8, 0, 0, 0, time.UTC)},
+		{"weekly across month", ScheduleWeekly, "08:00", "monday", time.Date(2026, time.October, 26, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.schedule, tt.at, tt.weekday)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(now); !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package dto
+
+import (
+	"encoding/json"
+	"maps"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 error response.
+// Clients should rely on Code (and Errors[].Code) rather than the human-readable fields.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	TraceID  string       `json:"trace_id,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	// additional problem-specific members, serialized alongside the standard ones
+	Extensions map[string]any `json:"-"`
+}
+
+// FieldError describes a single invalid request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	// alias type drops the MarshalJSON method, avoiding infinite recursion
+	type problem Problem
+	standard, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return standard, err
+	}
+
+	merged := make(map[string]any)
+	maps.Copy(merged, p.Extensions)
+	if err := json.Unmarshal(standard, &merged); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merged)
+}
@@ -1,6 +1,8 @@
 package dto
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
 )
@@ -12,3 +14,36 @@ type ReportRequest struct {
 	IssueID   *int            `json:"issue_id"`
 	Metadata  *datatypes.JSON `json:"metadata" binding:"max=2048"`
 }
+
+const (
+	BatchModeTransaction = "transaction"
+	BatchModeBestEffort  = "best_effort"
+
+	BatchOperationCreate = "create"
+	BatchOperationUpdate = "update"
+)
+
+type BatchReportRequest struct {
+	// "transaction" applies all items or none, "best_effort" (default) applies every valid item
+	Mode  string            `json:"mode" binding:"omitempty,oneof=transaction best_effort"`
+	Items []BatchReportItem `json:"items" binding:"required,min=1"`
+}
+
+// BatchReportItem is validated separately from the batch, so that an invalid item doesn't reject the whole batch
+type BatchReportItem struct {
+	Operation string `json:"op" binding:"required,oneof=create update"`
+	// when the client originally submitted the report, honored within the configured clock skew
+	SubmittedAt *time.Time `json:"submitted_at"`
+	ReportRequest
+}
+
+type CreateIssueRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Position int    `json:"position"`
+}
+
+// UpdateIssueRequest only changes the provided fields
+type UpdateIssueRequest struct {
+	Name     *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Position *int    `json:"position"`
+}
@@ -1,11 +1,17 @@
 package dto
 
 import (
+	"time"
+
 	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/reports"
+	"github.com/google/uuid"
 )
 
 type ReportResponse struct {
 	ReportRequest
+	// same as the ETag header of single report responses
+	Version int `json:"version"`
 }
 
 func MapReportToReportResponse(report models.Report) ReportResponse {
@@ -17,6 +23,7 @@ func MapReportToReportResponse(report models.Report) ReportResponse {
 			IssueID:   report.IssueID,
 			Metadata:  report.Metadata,
 		},
+		Version: report.Version,
 	}
 }
 
@@ -35,3 +42,126 @@ func MapIssuesToIssueResponses(issues []models.Issue) []IssueResponse {
 	}
 	return response
 }
+
+type AdminIssueResponse struct {
+	IssueResponse
+	Position int `json:"position"`
+	// disabled issue types are hidden from clients, but kept for existing reports
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func MapIssueToAdminIssueResponse(issue models.Issue) AdminIssueResponse {
+	return AdminIssueResponse{
+		IssueResponse: IssueResponse{ID: issue.ID, Name: issue.Name},
+		Position:      issue.Position,
+		Disabled:      issue.DeletedAt.Valid,
+		CreatedAt:     issue.CreatedAt,
+		UpdatedAt:     issue.UpdatedAt,
+	}
+}
+
+func MapIssuesToAdminIssueResponses(issues []models.Issue) []AdminIssueResponse {
+	response := make([]AdminIssueResponse, len(issues))
+	for i, issue := range issues {
+		response[i] = MapIssueToAdminIssueResponse(issue)
+	}
+	return response
+}
+
+type AdminReportResponse struct {
+	ReportResponse
+	// label of the submit token the report was created with
+	TokenLabel string    `json:"token_label"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func MapReportToAdminReportResponse(report models.Report) AdminReportResponse {
+	return AdminReportResponse{
+		ReportResponse: MapReportToReportResponse(report),
+		TokenLabel:     report.TokenLabel,
+		CreatedAt:      report.CreatedAt,
+		UpdatedAt:      report.UpdatedAt,
+	}
+}
+
+func MapReportsToAdminReportResponses(reports []models.Report) []AdminReportResponse {
+	response := make([]AdminReportResponse, len(reports))
+	for i, report := range reports {
+		response[i] = MapReportToAdminReportResponse(report)
+	}
+	return response
+}
+
+type StatsGroupResponse struct {
+	Group             *string `json:"group"`
+	Total             int64   `json:"total"`
+	Satisfied         int64   `json:"satisfied"`
+	SatisfactionRatio float64 `json:"satisfaction_ratio"`
+}
+
+type StatsResponse struct {
+	GroupBy string               `json:"group_by,omitempty"`
+	Groups  []StatsGroupResponse `json:"groups"`
+}
+
+func MapStatsToStatsResponse(groupBy string, stats []reports.Stats) StatsResponse {
+	groups := make([]StatsGroupResponse, len(stats))
+	for i, s := range stats {
+		groups[i] = StatsGroupResponse{
+			Group:             s.Group,
+			Total:             s.Total,
+			Satisfied:         s.Satisfied,
+			SatisfactionRatio: s.Ratio(),
+		}
+	}
+	return StatsResponse{
+		GroupBy: groupBy,
+		Groups:  groups,
+	}
+}
+
+const (
+	BatchStatusCreated  = "created"
+	BatchStatusUpdated  = "updated"
+	BatchStatusConflict = "conflict"
+	BatchStatusNotFound = "not_found"
+	BatchStatusInvalid  = "invalid"
+	BatchStatusFailed   = "failed"
+)
+
+type BatchItemResult struct {
+	Index  int             `json:"index"`
+	UUID   uuid.UUID       `json:"uuid"`
+	Status string          `json:"status"`
+	Report *ReportResponse `json:"report,omitempty"`
+	Errors []FieldError    `json:"errors,omitempty"`
+}
+
+type BatchReportResponse struct {
+	Mode    string            `json:"mode"`
+	Results []BatchItemResult `json:"results"`
+}
+
+type DigestResponse struct {
+	Recipients []string `json:"recipients"`
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// only set for checks which query something
+	DurationMs int64 `json:"duration_ms,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
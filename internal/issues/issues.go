@@ -0,0 +1,118 @@
+package issues
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Stogas/feedback-api/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// issue types are synced from the ISSUE_TYPES list on startup
+	ModeEnv = "env"
+	// issue types are managed through the admin API and UI
+	ModeAPI = "api"
+)
+
+var (
+	ErrNotFound   = errors.New("issue type not found")
+	ErrNameExists = errors.New("an enabled issue type with this name already exists")
+	ErrEmptyName  = errors.New("issue type name is empty")
+)
+
+// List returns all issue types in display order, including disabled ones
+func List(db *gorm.DB) ([]models.Issue, error) {
+	var issues []models.Issue
+	err := db.Unscoped().Order("position, id").Find(&issues).Error
+	return issues, err
+}
+
+// Create adds an enabled issue type
+func Create(db *gorm.DB, name string, position int) (models.Issue, error) {
+	issue := models.Issue{Name: strings.TrimSpace(name), Position: position}
+	if issue.Name == "" {
+		return issue, ErrEmptyName
+	}
+	if err := checkNameAvailable(db, issue.Name, 0); err != nil {
+		return issue, err
+	}
+	err := db.Create(&issue).Error
+	return issue, err
+}
+
+// Update renames and/or moves an issue type, keeping its ID so that reports stay linked to it
+func Update(db *gorm.DB, id uint, name *string, position *int) (models.Issue, error) {
+	issue, err := find(db, id)
+	if err != nil {
+		return issue, err
+	}
+
+	if name != nil {
+		trimmed := strings.TrimSpace(*name)
+		if trimmed == "" {
+			return issue, ErrEmptyName
+		}
+		if !issue.DeletedAt.Valid && trimmed != issue.Name {
+			if err := checkNameAvailable(db, trimmed, id); err != nil {
+				return issue, err
+			}
+		}
+		issue.Name = trimmed
+	}
+	if position != nil {
+		issue.Position = *position
+	}
+
+	err = db.Unscoped().Model(&issue).Select("name", "position").Updates(&issue).Error
+	return issue, err
+}
+
+// Disable hides an issue type from clients and rejects new reports with it, while existing reports keep it
+func Disable(db *gorm.DB, id uint) (models.Issue, error) {
+	issue, err := find(db, id)
+	if err != nil || issue.DeletedAt.Valid {
+		return issue, err
+	}
+	if err := db.Delete(&issue).Error; err != nil {
+		return issue, err
+	}
+	return find(db, id)
+}
+
+// Restore enables a disabled issue type again
+func Restore(db *gorm.DB, id uint) (models.Issue, error) {
+	issue, err := find(db, id)
+	if err != nil || !issue.DeletedAt.Valid {
+		return issue, err
+	}
+	if err := checkNameAvailable(db, issue.Name, id); err != nil {
+		return issue, err
+	}
+	if err := db.Unscoped().Model(&issue).Update("deleted_at", nil).Error; err != nil {
+		return issue, err
+	}
+	return find(db, id)
+}
+
+func find(db *gorm.DB, id uint) (models.Issue, error) {
+	var issue models.Issue
+	err := db.Unscoped().First(&issue, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return issue, ErrNotFound
+	}
+	return issue, err
+}
+
+// checkNameAvailable makes sure that clients can't see two issue types with the same name
+func checkNameAvailable(db *gorm.DB, name string, exceptID uint) error {
+	var count int64
+	err := db.Model(&models.Issue{}).Where("name = ? AND id <> ?", name, exceptID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrNameExists
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/config"
+)
+
+var errNotConfigured = errors.New("SMTP_HOST or SMTP_FROM is not set")
+
+// Message is an email with a plain text or HTML body
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+	HTML    bool
+}
+
+// Sender sends emails through an SMTP server. STARTTLS is used if the server supports it,
+// and authentication is only attempted when a username is configured.
+type Sender struct {
+	conf config.SMTPConfig
+	// may be rotated while running, conf.Password is only the initial one
+	password atomic.Pointer[string]
+}
+
+func NewSender(conf config.SMTPConfig) (*Sender, error) {
+	if conf.Host == "" || conf.From == "" {
+		return nil, errNotConfigured
+	}
+	s := &Sender{conf: conf}
+	s.SetPassword(conf.Password)
+	return s, nil
+}
+
+// SetPassword changes the password used by emails sent from now on
+func (s *Sender) SetPassword(password string) {
+	s.password.Store(&password)
+}
+
+func (s *Sender) Send(m Message) error {
+	if len(m.To) == 0 {
+		return errors.New("no recipients")
+	}
+
+	var auth smtp.Auth
+	if s.conf.Username != "" {
+		auth = smtp.PlainAuth("", s.conf.Username, *s.password.Load(), s.conf.Host)
+	}
+	msg, err := s.format(m)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(s.conf.Host, strconv.Itoa(s.conf.Port))
+	return smtp.SendMail(addr, auth, s.conf.From, m.To, msg)
+}
+
+func (s *Sender) format(m Message) ([]byte, error) {
+	contentType := "text/plain"
+	if m.HTML {
+		contentType = "text/html"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.conf.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	// keeps lines within the SMTP line length limit
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	b.WriteString("\r\n")
+	w := quotedprintable.NewWriter(&b)
+	if _, err := w.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))); err != nil {
+		return nil, fmt.Errorf("encoding body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("encoding body: %w", err)
+	}
+	return b.Bytes(), nil
+}
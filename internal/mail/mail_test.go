@@ -0,0 +1,74 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Stogas/feedback-api/internal/config"
+)
+
+func TestNewSender(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.SMTPConfig
+		wantErr bool
+	}{
+		{"configured", config.SMTPConfig{Host: "smtp.example.com", From: "feedback@example.com"}, false},
+		{"no host", config.SMTPConfig{From: "feedback@example.com"}, true},
+		{"no sender", config.SMTPConfig{Host: "smtp.example.com"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSender(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	s := &Sender{conf: config.SMTPConfig{From: "feedback@example.com"}}
+
+	tests := []struct {
+		name     string
+		message  Message
+		contains []string
+	}{
+		{
+			name:    "plain text",
+			message: Message{To: []string{"a@example.com", "b@example.com"}, Subject: "Alert", Body: "line 1\nline 2"},
+			contains: []string{
+				"From: feedback@example.com\r\n",
+				"To: a@example.com, b@example.com\r\n",
+				"Subject: Alert\r\n",
+				"Content-Type: text/plain; charset=utf-8\r\n",
+				"\r\n\r\nline 1\r\nline 2",
+			},
+		},
+		{
+			name:     "HTML with non-ASCII subject",
+			message:  Message{To: []string{"a@example.com"}, Subject: "Pasitenkinimas krito", Body: "<p>žemas</p>", HTML: true},
+			contains: []string{"Content-Type: text/html; charset=utf-8\r\n", "=C5=BEemas"},
+		},
+		{
+			name:     "long line",
+			message:  Message{To: []string{"a@example.com"}, Subject: "Digest", Body: strings.Repeat("x", 200)},
+			contains: []string{"=\r\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := s.format(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(string(msg), want) {
+					t.Errorf("message doesn't contain %q:\n%s", want, msg)
+				}
+			}
+		})
+	}
+}
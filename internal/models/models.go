@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
@@ -9,6 +11,8 @@ import (
 type Issue struct {
 	gorm.Model
 	Name string
+	// display order, ascending
+	Position int `gorm:"not null;default:0"`
 }
 
 type Report struct {
@@ -19,4 +23,70 @@ type Report struct {
 	IssueID   *int
 	Issue     *Issue
 	Metadata  *datatypes.JSON `binding:"max=2048"`
+	// incremented on every update, used for optimistic concurrency control
+	Version int `gorm:"not null;default:1"`
+	// label of the submit token the report was created with, empty if the submission routes are open
+	TokenLabel string `gorm:"not null;default:''"`
+}
+
+// APIKey authenticates clients of the admin API and UI. Only a hash of the key is stored.
+type APIKey struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"not null"`
+	// beginning of the key, to recognize it in listings
+	Prefix string `gorm:"not null"`
+	Hash   string `gorm:"not null;uniqueIndex"`
+	// "reader", "exporter" or "admin". Keys created before roles existed were allowed everything.
+	Role       string `gorm:"not null;default:admin"`
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// IdempotencyKey stores the response to the first successful request sent with an Idempotency-Key header,
+// so that it can be replayed to retries of the same request
+type IdempotencyKey struct {
+	// the client which sent the request, so that keys chosen by different clients can't collide
+	Client string `gorm:"primaryKey"`
+	Key    string `gorm:"primaryKey"`
+	// hash of the method, path and body of the first request
+	RequestHash string
+	// 0 while the first request is still being processed
+	StatusCode  int
+	ContentType string
+	// headers of the response which are replayed along with its body
+	ETag      string
+	Location  string
+	Response  []byte
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// SignatureNonce is a nonce of a signed request, stored so that the request can't be replayed
+type SignatureNonce struct {
+	Client    string    `gorm:"primaryKey"`
+	Nonce     string    `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// Alert is a firing or resolved instance of an alerting rule, for a single group if the rule is grouped.
+// It's persisted so that notifications are deduplicated across restarts and replicas.
+type Alert struct {
+	ID   uint   `gorm:"primarykey"`
+	Rule string `gorm:"not null;index"`
+	// value of the rule's grouping, "" if the rule isn't grouped
+	GroupKey string `gorm:"not null"`
+	// the evaluated value when the alert was last notified
+	Value          float64
+	Reports        int64
+	StartedAt      time.Time
+	LastNotifiedAt time.Time
+	// nil while firing
+	ResolvedAt *time.Time `gorm:"index"`
+}
+
+// DigestRun claims sending the digest of a period, so that only one replica sends it
+type DigestRun struct {
+	PeriodEnd time.Time `gorm:"primaryKey"`
+	CreatedAt time.Time
 }
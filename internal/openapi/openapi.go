@@ -0,0 +1,227 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/Stogas/feedback-api/internal/signing"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	submitTokenScheme     = "submitToken"
+	submitSignatureScheme = "submitSignature"
+	apiKeyScheme          = "apiKey"
+)
+
+var (
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	jsonType = reflect.TypeOf(datatypes.JSON{})
+)
+
+// New builds the OpenAPI 3 document describing the API.
+// Schemas are generated from the dto types, so they can't drift from what the handlers bind and return.
+func New(version string) (*openapi3.T, error) {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:       "Feedback API",
+			Description: "Submission and updates of user satisfaction reports",
+			Version:     version,
+		},
+		Paths: openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			Schemas: make(openapi3.Schemas),
+			SecuritySchemes: openapi3.SecuritySchemes{
+				submitTokenScheme: &openapi3.SecuritySchemeRef{Value: openapi3.NewSecurityScheme().
+					WithType("apiKey").WithIn("header").WithName("X-Feedback-Submit-Token")},
+				submitSignatureScheme: &openapi3.SecuritySchemeRef{Value: openapi3.NewSecurityScheme().
+					WithType("apiKey").WithIn("header").WithName(signing.HeaderSignature).
+					WithDescription("Hex HMAC-SHA256 of the method, path with query, timestamp, nonce and hex SHA-256 of the body, " +
+						"each on its own line, signed with the client's secret. Requires the " + signing.HeaderClient + ", " +
+						signing.HeaderTimestamp + " (Unix seconds) and " + signing.HeaderNonce + " headers too.")},
+				apiKeyScheme: &openapi3.SecuritySchemeRef{Value: openapi3.NewSecurityScheme().
+					WithType("http").WithScheme("bearer").WithDescription("API key created with 'feedback-api keys create'")},
+			},
+		},
+	}
+
+	g := &generator{
+		doc: doc,
+		gen: openapi3gen.NewGenerator(openapi3gen.SchemaCustomizer(customizeSchema)),
+	}
+	g.addRoutes()
+
+	if g.err != nil {
+		return nil, g.err
+	}
+	return doc, nil
+}
+
+// customizeSchema maps types and binding tags which openapi3gen doesn't understand
+func customizeSchema(_ string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+	switch t {
+	case uuidType:
+		schema.Type = &openapi3.Types{"string"}
+		schema.Format = "uuid"
+	case jsonType:
+		// arbitrary JSON
+		schema.Type = nil
+		schema.Format = ""
+	}
+
+	if t.Kind() == reflect.Struct {
+		for _, f := range reflect.VisibleFields(t) {
+			if !f.Anonymous && slices.Contains(bindingRules(f.Tag), "required") {
+				schema.Required = append(schema.Required, jsonName(f))
+			}
+		}
+	}
+
+	for _, rule := range bindingRules(tag) {
+		switch {
+		case rule == "required":
+			schema.Nullable = false
+		case strings.HasPrefix(rule, "max=") && t.Kind() == reflect.String:
+			maxLength, err := strconv.ParseUint(strings.TrimPrefix(rule, "max="), 10, 64)
+			if err != nil {
+				return err
+			}
+			schema.MaxLength = &maxLength
+		case strings.HasPrefix(rule, "min=") && t.Kind() == reflect.Slice:
+			minItems, err := strconv.ParseUint(strings.TrimPrefix(rule, "min="), 10, 64)
+			if err != nil {
+				return err
+			}
+			schema.MinItems = minItems
+		case strings.HasPrefix(rule, "oneof="):
+			for _, v := range strings.Fields(strings.TrimPrefix(rule, "oneof=")) {
+				schema.Enum = append(schema.Enum, v)
+			}
+		}
+	}
+	return nil
+}
+
+func bindingRules(tag reflect.StructTag) []string {
+	binding := tag.Get("binding")
+	if binding == "" {
+		return nil
+	}
+	return strings.Split(binding, ",")
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// generator accumulates the document, remembering the first error
+type generator struct {
+	doc *openapi3.T
+	gen *openapi3gen.Generator
+	err error
+
+	// API version prefixed to the paths and operation IDs of added operations, if any
+	version string
+	// whether added operations are deprecated (unversioned aliases of the current version)
+	deprecated bool
+}
+
+// schema returns a reference to the component schema generated from a dto value.
+// Slices are described as arrays of their element's component schema.
+func (g *generator) schema(value any) *openapi3.SchemaRef {
+	t := reflect.TypeOf(value)
+	if t.Kind() == reflect.Slice {
+		elem := reflect.New(t.Elem()).Elem().Interface()
+		return openapi3.NewArraySchema().WithItems(g.schema(elem).Value).NewRef()
+	}
+
+	if _, ok := g.doc.Components.Schemas[t.Name()]; !ok {
+		ref, err := g.gen.NewSchemaRefForValue(value, nil)
+		if err != nil {
+			if g.err == nil {
+				g.err = err
+			}
+			return openapi3.NewSchemaRef("", openapi3.NewSchema())
+		}
+		g.doc.Components.Schemas[t.Name()] = ref
+	}
+	return openapi3.NewSchemaRef("#/components/schemas/"+t.Name(), g.doc.Components.Schemas[t.Name()].Value)
+}
+
+func (g *generator) response(description string, value any) *openapi3.ResponseRef {
+	r := openapi3.NewResponse().WithDescription(description)
+	if value != nil {
+		r.Content = openapi3.NewContentWithJSONSchemaRef(g.schema(value))
+	}
+	return &openapi3.ResponseRef{Value: r}
+}
+
+// eventStream describes a text/event-stream response, whose event data can only be referenced as a schema
+func (g *generator) eventStream(description string, data any) *openapi3.ResponseRef {
+	r := openapi3.NewResponse().WithDescription(description)
+	r.Content = openapi3.Content{"text/event-stream": openapi3.NewMediaType().WithSchemaRef(g.schema(data))}
+	return &openapi3.ResponseRef{Value: r}
+}
+
+func (g *generator) problem(description string) *openapi3.ResponseRef {
+	r := openapi3.NewResponse().WithDescription(description)
+	r.Content = openapi3.Content{dto.ProblemContentType: openapi3.NewMediaType().WithSchemaRef(g.schema(dto.Problem{}))}
+	return &openapi3.ResponseRef{Value: r}
+}
+
+func (g *generator) requestBody(value any) *openapi3.RequestBodyRef {
+	return &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().
+		WithRequired(true).
+		WithContent(openapi3.NewContentWithJSONSchemaRef(g.schema(value)))}
+}
+
+// add registers an operation with the given responses, keyed by HTTP status
+func (g *generator) add(method string, path string, op *openapi3.Operation, responses map[int]*openapi3.ResponseRef) {
+	op.Responses = openapi3.NewResponses()
+	op.Responses.Delete("default")
+	for status, r := range responses {
+		op.Responses.Set(strconv.Itoa(status), r)
+	}
+	if _, ok := responses[http.StatusInternalServerError]; !ok {
+		op.Responses.Set(strconv.Itoa(http.StatusInternalServerError), g.problem("Internal error"))
+	}
+	// all versioned routes use the database, which they wait for on startup
+	if _, ok := responses[http.StatusServiceUnavailable]; !ok && (g.version != "" || g.deprecated) {
+		op.Responses.Set(strconv.Itoa(http.StatusServiceUnavailable), g.problem("The service is starting"))
+	}
+
+	if g.version != "" {
+		path = "/" + g.version + path
+		op.OperationID = g.version + strings.ToUpper(op.OperationID[:1]) + op.OperationID[1:]
+	}
+	if g.deprecated {
+		op.Deprecated = true
+		op.OperationID = "legacy" + strings.ToUpper(op.OperationID[:1]) + op.OperationID[1:]
+	}
+	g.doc.AddOperation(path, method, op)
+}
+
+// security requires any one of the schemes
+func security(schemes ...string) *openapi3.SecurityRequirements {
+	requirements := openapi3.NewSecurityRequirements()
+	for _, scheme := range schemes {
+		requirements.With(openapi3.NewSecurityRequirement().Authenticate(scheme))
+	}
+	return requirements
+}
+
+func queryParam(name string, description string, schema *openapi3.Schema) *openapi3.ParameterRef {
+	return &openapi3.ParameterRef{Value: openapi3.NewQueryParameter(name).WithDescription(description).WithSchema(schema)}
+}
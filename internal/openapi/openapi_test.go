@@ -0,0 +1,54 @@
+package openapi
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func TestNew(t *testing.T) {
+	doc, err := New("test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("generated document is invalid: %v", err)
+	}
+
+	tests := []struct {
+		method     string
+		path       string
+		scheme     string
+		deprecated bool
+	}{
+		{http.MethodPost, "/v1/submit/report", submitTokenScheme, false},
+		{http.MethodPatch, "/v1/submit/report", submitTokenScheme, false},
+		{http.MethodGet, "/v1/admin/reports", apiKeyScheme, false},
+		{http.MethodGet, "/v1/admin/reports/stats", apiKeyScheme, false},
+		{http.MethodPost, "/submit/report", submitTokenScheme, true},
+		{http.MethodGet, "/admin/reports", apiKeyScheme, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			op := doc.Paths.Find(tt.path).GetOperation(tt.method)
+			if op == nil {
+				t.Fatal("operation is missing")
+			}
+			if op.Deprecated != tt.deprecated {
+				t.Errorf("got deprecated %v, want %v", op.Deprecated, tt.deprecated)
+			}
+			if op.Security == nil || !slices.ContainsFunc(*op.Security, func(req openapi3.SecurityRequirement) bool {
+				_, ok := req[tt.scheme]
+				return ok
+			}) {
+				t.Errorf("expected the %s scheme, got %v", tt.scheme, op.Security)
+			}
+			if op.Responses.Status(http.StatusUnauthorized) == nil {
+				t.Error("expected a 401 response")
+			}
+		})
+	}
+}
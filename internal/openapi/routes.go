@@ -0,0 +1,310 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func (g *generator) addRoutes() {
+	g.addUnversionedRoutes()
+
+	g.version = "v1"
+	g.addVersionedRoutes()
+
+	// unversioned aliases of /v1
+	g.version = ""
+	g.deprecated = true
+	g.addVersionedRoutes()
+}
+
+func (g *generator) addVersionedRoutes() {
+	g.add(http.MethodGet, "/issues", &openapi3.Operation{
+		OperationID: "getIssues",
+		Summary:     "List known issue types",
+	}, map[int]*openapi3.ResponseRef{
+		http.StatusOK: g.response("Issue types", []dto.IssueResponse{}),
+	})
+	g.addSubmitRoutes()
+	g.addAdminRoutes()
+}
+
+func (g *generator) addUnversionedRoutes() {
+	g.add(http.MethodGet, "/ping", &openapi3.Operation{
+		OperationID: "ping",
+		Summary:     "Check that the API is up",
+	}, map[int]*openapi3.ResponseRef{
+		http.StatusOK: g.response("Pong", nil),
+	})
+
+	g.add(http.MethodGet, "/healthz", &openapi3.Operation{
+		OperationID: "getHealth",
+		Summary:     "Check that the process is alive, for liveness probes",
+	}, map[int]*openapi3.ResponseRef{
+		http.StatusOK: g.response("Alive", dto.HealthResponse{}),
+	})
+
+	g.add(http.MethodGet, "/readyz", &openapi3.Operation{
+		OperationID: "getReadiness",
+		Summary:     "Check that the API is ready to serve requests, for readiness probes",
+		Description: "The API is not ready while starting, shutting down, or if the database can't be reached. The result of each check is listed.",
+	}, map[int]*openapi3.ResponseRef{
+		http.StatusOK:                 g.response("Ready", dto.ReadinessResponse{}),
+		http.StatusServiceUnavailable: g.response("Starting, shutting down or failing checks", dto.ReadinessResponse{}),
+	})
+
+	g.add(http.MethodGet, "/openapi.json", &openapi3.Operation{
+		OperationID: "getOpenAPI",
+		Summary:     "This OpenAPI document",
+	}, map[int]*openapi3.ResponseRef{
+		http.StatusOK: g.response("OpenAPI document", nil),
+	})
+}
+
+func (g *generator) addSubmitRoutes() {
+	g.add(http.MethodPost, "/submit/report", &openapi3.Operation{
+		OperationID: "submitReport",
+		Summary:     "Create a new report with a client-generated UUID",
+		Security:    security(submitTokenScheme, submitSignatureScheme),
+		Parameters:  openapi3.Parameters{idempotencyKeyParam()},
+		RequestBody: g.requestBody(dto.ReportRequest{}),
+	}, map[int]*openapi3.ResponseRef{
+		http.StatusCreated:      g.response("Report created", dto.ReportResponse{}),
+		http.StatusBadRequest:   g.problem("Invalid request"),
+		http.StatusUnauthorized: g.problem("Missing or incorrect submit token"),
+		http.StatusConflict:     g.problem("A report with this UUID already exists"),
+	})
+
+	g.add(http.MethodPatch, "/submit/report", &openapi3.Operation{
+		OperationID: "updateReport",
+		Summary:     "Update an existing report",
+		Security:    security(submitTokenScheme, submitSignatureScheme),
+		Parameters: openapi3.Parameters{
+			idempotencyKeyParam(),
+			&openapi3.ParameterRef{Value: openapi3.NewHeaderParameter("If-Match").
+				WithDescription("ETag of the report as last read, the update is rejected if the report has changed since").
+				WithSchema(openapi3.NewStringSchema())},
+		},
+		RequestBody: g.requestBody(dto.ReportRequest{}),
+	}, map[int]*openapi3.ResponseRef{
+		http.StatusOK:                 g.response("Report updated", dto.ReportResponse{}),
+		http.StatusBadRequest:         g.problem("Invalid request"),
+		http.StatusUnauthorized:       g.problem("Missing or incorrect submit token"),
+		http.StatusNotFound:           g.problem("A report with this UUID does not exist"),
+		http.StatusPreconditionFailed: g.problem("The report has changed since it was last read"),
+	})
+
+	g.addSubmitReportUUIDRoutes()
+
+	g.add(http.MethodPost, "/submit/reports:batch", &openapi3.Operation{
+		OperationID: "submitReportsBatch",
+		Summary:     "Create and update multiple reports, e.g. queued by an offline client",
+		Description: "Items are applied in order, and the result of each is reported. " +
+			"In transaction mode, no items are applied if any of them can't be.",
+		Security:    security(submitTokenScheme, submitSignatureScheme),
+		Parameters:  openapi3.Parameters{idempotencyKeyParam()},
+		RequestBody: g.requestBody(dto.BatchReportRequest{}),
+	}, map[int]*openapi3.ResponseRef{
+		http.StatusOK:                  g.response("Per-item results", dto.BatchReportResponse{}),
+		http.StatusBadRequest:          g.problem("Invalid request"),
+		http.StatusUnauthorized:        g.problem("Missing or incorrect submit token"),
+		http.StatusUnprocessableEntity: g.problem("Transaction rolled back, per-item results are in 'results'"),
+	})
+}
+
+// addSubmitReportUUIDRoutes adds the routes addressing a report by the UUID in the path
+func (g *generator) addSubmitReportUUIDRoutes() {
+	g.add(http.MethodGet, "/submit/report/{uuid}", &openapi3.Operation{
+		OperationID: "getReport",
+		Summary:     "Get a report, e.g. to read its current ETag",
+		Security:    security(submitTokenScheme, submitSignatureScheme),
+		Parameters: openapi3.Parameters{
+			reportUUIDParam("UUID of the report"),
+			&openapi3.ParameterRef{Value: openapi3.NewHeaderParameter("If-None-Match").
+				WithDescription("ETag of the report as last read, 304 is returned if the report hasn't changed since").
+				WithSchema(openapi3.NewStringSchema())},
+		},
+	}, map[int]*openapi3.ResponseRef{
+		http.StatusOK:           g.response("Report", dto.ReportResponse{}),
+		http.StatusNotModified:  g.response("Report not modified", nil),
+		http.StatusBadRequest:   g.problem("Invalid request"),
+		http.StatusUnauthorized: g.problem("Missing or incorrect submit token"),
+		http.StatusNotFound:     g.problem("A report with this UUID does not exist"),
+	})
+
+	g.add(http.MethodPut, "/submit/report/{uuid}", &openapi3.Operation{
+		OperationID: "upsertReport",
+		Summary:     "Create a report, or replace it if it already exists",
+		Security:    security(submitTokenScheme, submitSignatureScheme),
+		Parameters: openapi3.Parameters{
+			reportUUIDParam("Must match the UUID in the body"),
+			idempotencyKeyParam(),
+		},
+		RequestBody: g.requestBody(dto.ReportRequest{}),
+	}, map[int]*openapi3.ResponseRef{
+		http.StatusOK:           g.response("Report replaced", dto.ReportResponse{}),
+		http.StatusCreated:      g.response("Report created", dto.ReportResponse{}),
+		http.StatusBadRequest:   g.problem("Invalid request"),
+		http.StatusUnauthorized: g.problem("Missing or incorrect submit token"),
+		http.StatusConflict:     g.problem("A request with this Idempotency-Key is still being processed"),
+	})
+}
+
+// adminResponses adds the responses to requests without a valid API key of the required role
+func (g *generator) adminResponses(responses map[int]*openapi3.ResponseRef) map[int]*openapi3.ResponseRef {
+	responses[http.StatusUnauthorized] = g.problem("Missing, unknown, revoked or expired API key")
+	responses[http.StatusForbidden] = g.problem("The API key's role is not allowed to do this")
+	return responses
+}
+
+func (g *generator) addAdminRoutes() {
+	g.addAdminReportRoutes()
+	g.addAdminIssueRoutes()
+
+	g.add(http.MethodPost, "/admin/digest/send", &openapi3.Operation{
+		OperationID: "sendDigest",
+		Summary:     "Send the digest email of the period ending now",
+		Description: "Requires the admin role. Only available if digest emails are enabled.",
+		Security:    security(apiKeyScheme),
+	}, g.adminResponses(map[int]*openapi3.ResponseRef{
+		http.StatusOK: g.response("Digest sent", dto.DigestResponse{}),
+	}))
+
+	g.addStreamRoutes()
+}
+
+func (g *generator) addAdminReportRoutes() {
+	g.add(http.MethodGet, "/admin/reports", &openapi3.Operation{
+		OperationID: "listReports",
+		Summary:     "List reports, newest first",
+		Description: "Requires the exporter role.",
+		Security:    security(apiKeyScheme),
+		Parameters: append(reportFilterParams(),
+			queryParam("limit", "Maximum number of reports", openapi3.NewIntegerSchema().WithMin(1).WithMax(500)),
+			queryParam("offset", "Number of reports to skip", openapi3.NewIntegerSchema().WithMin(0)),
+		),
+	}, g.adminResponses(map[int]*openapi3.ResponseRef{
+		http.StatusOK:         g.response("Reports", []dto.AdminReportResponse{}),
+		http.StatusBadRequest: g.problem("Invalid query"),
+	}))
+
+	g.add(http.MethodGet, "/admin/reports/stats", &openapi3.Operation{
+		OperationID: "getReportStats",
+		Summary:     "Aggregate satisfaction stats of reports",
+		Description: "Requires the reader role.",
+		Security:    security(apiKeyScheme),
+		Parameters: append(reportFilterParams(),
+			queryParam("group_by", "'issue', 'satisfied', 'token' or 'metadata.<key>'", openapi3.NewStringSchema()),
+		),
+	}, g.adminResponses(map[int]*openapi3.ResponseRef{
+		http.StatusOK:         g.response("Stats", dto.StatsResponse{}),
+		http.StatusBadRequest: g.problem("Invalid query"),
+	}))
+}
+
+func (g *generator) addAdminIssueRoutes() {
+	g.add(http.MethodGet, "/admin/issues", &openapi3.Operation{
+		OperationID: "listAdminIssues",
+		Summary:     "List issue types, including disabled ones",
+		Description: "Requires the reader role.",
+		Security:    security(apiKeyScheme),
+	}, g.adminResponses(map[int]*openapi3.ResponseRef{
+		http.StatusOK: g.response("Issue types", []dto.AdminIssueResponse{}),
+	}))
+
+	envManaged := g.problem("Issue types are managed with ISSUE_TYPES")
+	g.add(http.MethodPost, "/admin/issues", &openapi3.Operation{
+		OperationID: "createIssue",
+		Summary:     "Create an issue type",
+		Description: "Requires the admin role.",
+		Security:    security(apiKeyScheme),
+		RequestBody: g.requestBody(dto.CreateIssueRequest{}),
+	}, g.adminResponses(map[int]*openapi3.ResponseRef{
+		http.StatusCreated:    g.response("Issue type created", dto.AdminIssueResponse{}),
+		http.StatusBadRequest: g.problem("Invalid request"),
+		http.StatusConflict:   envManaged,
+	}))
+
+	g.add(http.MethodPatch, "/admin/issues/{id}", &openapi3.Operation{
+		OperationID: "updateIssue",
+		Summary:     "Rename or reorder an issue type, keeping its reports linked",
+		Description: "Requires the admin role.",
+		Security:    security(apiKeyScheme),
+		Parameters:  openapi3.Parameters{issueIDParam()},
+		RequestBody: g.requestBody(dto.UpdateIssueRequest{}),
+	}, g.adminResponses(map[int]*openapi3.ResponseRef{
+		http.StatusOK:         g.response("Issue type updated", dto.AdminIssueResponse{}),
+		http.StatusBadRequest: g.problem("Invalid request"),
+		http.StatusNotFound:   g.problem("Issue type not found"),
+		http.StatusConflict:   envManaged,
+	}))
+
+	g.add(http.MethodDelete, "/admin/issues/{id}", &openapi3.Operation{
+		OperationID: "disableIssue",
+		Summary:     "Disable an issue type, hiding it from clients while keeping existing reports",
+		Description: "Requires the admin role.",
+		Security:    security(apiKeyScheme),
+		Parameters:  openapi3.Parameters{issueIDParam()},
+	}, g.adminResponses(map[int]*openapi3.ResponseRef{
+		http.StatusOK:       g.response("Issue type disabled", dto.AdminIssueResponse{}),
+		http.StatusNotFound: g.problem("Issue type not found"),
+		http.StatusConflict: envManaged,
+	}))
+
+	g.add(http.MethodPost, "/admin/issues/{id}/restore", &openapi3.Operation{
+		OperationID: "restoreIssue",
+		Summary:     "Enable a disabled issue type again",
+		Description: "Requires the admin role.",
+		Security:    security(apiKeyScheme),
+		Parameters:  openapi3.Parameters{issueIDParam()},
+	}, g.adminResponses(map[int]*openapi3.ResponseRef{
+		http.StatusOK:       g.response("Issue type restored", dto.AdminIssueResponse{}),
+		http.StatusNotFound: g.problem("Issue type not found"),
+		http.StatusConflict: envManaged,
+	}))
+}
+
+func (g *generator) addStreamRoutes() {
+	g.add(http.MethodGet, "/stream/reports", &openapi3.Operation{
+		OperationID: "streamReports",
+		Summary:     "Stream report changes as server-sent events",
+		Description: "Requires the exporter role. Events are named 'report.created' or 'report.updated', their data is an AdminReportResponse.",
+		Security:    security(apiKeyScheme),
+		Parameters:  reportFilterParams(),
+	}, g.adminResponses(map[int]*openapi3.ResponseRef{
+		http.StatusOK:         g.eventStream("Stream of report events", dto.AdminReportResponse{}),
+		http.StatusBadRequest: g.problem("Invalid query"),
+	}))
+}
+
+func reportUUIDParam(description string) *openapi3.ParameterRef {
+	return &openapi3.ParameterRef{Value: openapi3.NewPathParameter("uuid").
+		WithDescription(description).
+		WithSchema(openapi3.NewUUIDSchema())}
+}
+
+func issueIDParam() *openapi3.ParameterRef {
+	return &openapi3.ParameterRef{Value: openapi3.NewPathParameter("id").
+		WithSchema(openapi3.NewIntegerSchema().WithMin(1))}
+}
+
+func idempotencyKeyParam() *openapi3.ParameterRef {
+	return &openapi3.ParameterRef{Value: openapi3.NewHeaderParameter("Idempotency-Key").
+		WithDescription("Unique key of this request, retries with the same key get the stored response of the first successful request").
+		WithSchema(openapi3.NewStringSchema().WithMaxLength(255))}
+}
+
+// reportFilterParams describes the query parameters parsed by reports.ParseFilter.
+// Filters on metadata keys (metadata.<key>) can't be described by OpenAPI 3.0 and are only documented.
+func reportFilterParams() openapi3.Parameters {
+	return openapi3.Parameters{
+		queryParam("satisfied", "Only satisfied or unsatisfied reports", openapi3.NewBoolSchema()),
+		queryParam("issue_id", "Only reports with this issue type", openapi3.NewIntegerSchema()),
+		queryParam("from", "Only reports created at or after this time", openapi3.NewDateTimeSchema()),
+		queryParam("to", "Only reports created before this time", openapi3.NewDateTimeSchema()),
+		queryParam("project", "Only reports of this project, same as metadata.project", openapi3.NewStringSchema()),
+		queryParam("comment", "Only reports whose comment contains this text, case-insensitive", openapi3.NewStringSchema()),
+		queryParam("token", "Only reports created with the submit token with this label", openapi3.NewStringSchema()),
+	}
+}
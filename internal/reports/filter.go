@@ -0,0 +1,227 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	metadataPrefix = "metadata."
+
+	// reports are assigned to projects by this metadata key
+	projectMetadataKey = "project"
+)
+
+// metadata keys are interpolated into SQL expressions (so that they match the
+// expression indexes), so they are restricted to a safe character set.
+// The length limit keeps index names within Postgres' 63 byte identifier limit.
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,42}$`)
+
+// Filter narrows down which reports are listed or aggregated
+type Filter struct {
+	Satisfied *bool
+	IssueID   *int
+	From      *time.Time
+	To        *time.Time
+	Metadata  map[string]string
+	// case-insensitive substring of the comment
+	Comment string
+	// label of the submit token reports were created with
+	TokenLabel *string
+}
+
+// ValidMetadataKey reports whether a metadata key can be used in filters, groupings and indexes
+func ValidMetadataKey(key string) bool {
+	return metadataKeyPattern.MatchString(key)
+}
+
+// MetadataExpr returns the SQL expression extracting a top-level metadata key as text.
+// It must be kept identical to the expression used by the promoted key indexes,
+// otherwise Postgres will not use them.
+func MetadataExpr(key string) string {
+	return fmt.Sprintf("(metadata->>'%s')", key)
+}
+
+// ParseFilter builds a Filter from URL query parameters:
+// satisfied, issue_id, from, to (RFC3339), metadata.<key>, project (same as metadata.project), comment and token
+func ParseFilter(q url.Values) (Filter, error) {
+	var f Filter
+
+	if v := q.Get("satisfied"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid 'satisfied' value %q", v)
+		}
+		f.Satisfied = &b
+	}
+
+	if v := q.Get("issue_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid 'issue_id' value %q", v)
+		}
+		f.IssueID = &id
+	}
+
+	var err error
+	if f.From, err = parseTime(q, "from"); err != nil {
+		return f, err
+	}
+	if f.To, err = parseTime(q, "to"); err != nil {
+		return f, err
+	}
+
+	for param, values := range q {
+		key, ok := strings.CutPrefix(param, metadataPrefix)
+		if !ok {
+			continue
+		}
+		if !ValidMetadataKey(key) {
+			return f, fmt.Errorf("invalid metadata key %q", key)
+		}
+		if f.Metadata == nil {
+			f.Metadata = make(map[string]string)
+		}
+		f.Metadata[key] = values[0]
+	}
+
+	f.Comment = q.Get("comment")
+
+	// an empty token matches reports submitted while the submission routes were open
+	if q.Has("token") {
+		label := q.Get("token")
+		f.TokenLabel = &label
+	}
+
+	if v := q.Get("project"); v != "" {
+		if f.Metadata == nil {
+			f.Metadata = make(map[string]string)
+		}
+		f.Metadata[projectMetadataKey] = v
+	}
+
+	return f, nil
+}
+
+// escapes LIKE wildcards, so that comment searches match them literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func parseTime(q url.Values, param string) (*time.Time, error) {
+	v := q.Get(param)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid '%s' value %q, expected RFC3339", param, v)
+	}
+	return &t, nil
+}
+
+// condition is a single filter condition, described both as SQL and as a Go predicate,
+// so that streamed reports are selected exactly like queried ones
+type condition struct {
+	query string
+	value any
+	match func(r models.Report) bool
+}
+
+// conditions returns the conditions of all set filter fields
+func (f Filter) conditions() []condition {
+	var conds []condition
+	if f.Satisfied != nil {
+		satisfied := *f.Satisfied
+		conds = append(conds, condition{"satisfied = ?", satisfied, func(r models.Report) bool {
+			return r.Satisfied != nil && *r.Satisfied == satisfied
+		}})
+	}
+	if f.IssueID != nil {
+		issueID := *f.IssueID
+		conds = append(conds, condition{"issue_id = ?", issueID, func(r models.Report) bool {
+			return r.IssueID != nil && *r.IssueID == issueID
+		}})
+	}
+	if f.From != nil {
+		from := *f.From
+		conds = append(conds, condition{"created_at >= ?", from, func(r models.Report) bool {
+			return !r.CreatedAt.Before(from)
+		}})
+	}
+	if f.To != nil {
+		to := *f.To
+		conds = append(conds, condition{"created_at < ?", to, func(r models.Report) bool {
+			return r.CreatedAt.Before(to)
+		}})
+	}
+	for key, value := range f.Metadata {
+		conds = append(conds, condition{MetadataExpr(key) + " = ?", value, func(r models.Report) bool {
+			text, ok := metadataValue(r, key)
+			return ok && text == value
+		}})
+	}
+	if f.Comment != "" {
+		comment := strings.ToLower(f.Comment)
+		conds = append(conds, condition{"comment ILIKE ?", "%" + likeEscaper.Replace(f.Comment) + "%", func(r models.Report) bool {
+			return strings.Contains(strings.ToLower(r.Comment), comment)
+		}})
+	}
+	if f.TokenLabel != nil {
+		label := *f.TokenLabel
+		conds = append(conds, condition{"token_label = ?", label, func(r models.Report) bool {
+			return r.TokenLabel == label
+		}})
+	}
+	return conds
+}
+
+// Apply adds the filter conditions to a query on the reports table
+func (f Filter) Apply(db *gorm.DB) *gorm.DB {
+	for _, cond := range f.conditions() {
+		db = db.Where(cond.query, cond.value)
+	}
+	return db
+}
+
+// Matches reports whether a report satisfies the filter, the same way Apply would select it
+func (f Filter) Matches(r models.Report) bool {
+	for _, cond := range f.conditions() {
+		if !cond.match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataValue returns a top-level metadata key of a report as text, like MetadataExpr does
+func metadataValue(r models.Report, key string) (string, bool) {
+	if r.Metadata == nil {
+		return "", false
+	}
+	var metadata map[string]json.RawMessage
+	if err := json.Unmarshal(*r.Metadata, &metadata); err != nil {
+		return "", false
+	}
+	return metadataText(metadata[key])
+}
+
+// metadataText converts a JSON value to text like Postgres' ->> operator does, returning false for null or missing values
+func metadataText(raw json.RawMessage) (string, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", false
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+	// Postgres normalizes the whitespace of nested objects and arrays, which is not replicated here
+	return string(bytes.TrimSpace(raw)), true
+}
@@ -0,0 +1,173 @@
+package reports
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+		check   func(t *testing.T, f Filter)
+	}{
+		{
+			name:  "empty",
+			query: "",
+			check: func(t *testing.T, f Filter) {
+				if f.Satisfied != nil || f.IssueID != nil || f.From != nil || f.To != nil || f.Metadata != nil {
+					t.Errorf("expected an empty filter, got %+v", f)
+				}
+			},
+		},
+		{
+			name:  "all parameters",
+			query: "satisfied=false&issue_id=3&from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z&metadata.app_version=1.2&metadata.page=/checkout",
+			check: func(t *testing.T, f Filter) {
+				if f.Satisfied == nil || *f.Satisfied {
+					t.Errorf("satisfied: got %v, want false", f.Satisfied)
+				}
+				if f.IssueID == nil || *f.IssueID != 3 {
+					t.Errorf("issue_id: got %v, want 3", f.IssueID)
+				}
+				if f.From == nil || !f.From.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("from: got %v", f.From)
+				}
+				if f.To == nil || !f.To.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("to: got %v", f.To)
+				}
+				if len(f.Metadata) != 2 || f.Metadata["app_version"] != "1.2" || f.Metadata["page"] != "/checkout" {
+					t.Errorf("metadata: got %v", f.Metadata)
+				}
+			},
+		},
+		{name: "invalid satisfied", query: "satisfied=maybe", wantErr: true},
+		{name: "invalid issue_id", query: "issue_id=abc", wantErr: true},
+		{name: "time without zone", query: "from=2024-01-01T00:00:00", wantErr: true},
+		{name: "metadata key with quote", query: "metadata.a'b=1", wantErr: true},
+		{name: "empty metadata key", query: "metadata.=1", wantErr: true},
+		{name: "metadata key too long", query: "metadata.abcdefghijklmnopqrstuvwxyzabcdefghijklmnopq=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := ParseFilter(q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, f)
+			}
+		})
+	}
+}
+
+func TestGroupByExpr(t *testing.T) {
+	tests := []struct {
+		groupBy string
+		want    string
+		wantErr bool
+	}{
+		{groupBy: "", want: ""},
+		{groupBy: "issue", want: "issue_id::text"},
+		{groupBy: "satisfied", want: "satisfied::text"},
+		{groupBy: "metadata.app_version", want: "(metadata->>'app_version')"},
+		{groupBy: "metadata.x);DROP TABLE reports;--", wantErr: true},
+		{groupBy: "comment", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			got, err := GroupByExpr(tt.groupBy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+var (
+	matchTime     = time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	matchMetadata = datatypes.JSON(`{"page":"/checkout","build":42,"beta":true,"tags":["a"],"empty":null}`)
+)
+
+// filterMatchTests pairs the SQL each filter field is applied as with how Matches evaluates it
+var filterMatchTests = []struct {
+	name    string
+	filter  Filter
+	report  models.Report
+	wantSQL string
+	want    bool
+}{
+	{"empty filter", Filter{}, models.Report{}, "", true},
+	{"satisfied", Filter{Satisfied: ptr(true)}, models.Report{Satisfied: ptr(true)}, "satisfied = true", true},
+	{"unsatisfied", Filter{Satisfied: ptr(false)}, models.Report{Satisfied: ptr(true)}, "satisfied = false", false},
+	{"satisfied NULL", Filter{Satisfied: ptr(false)}, models.Report{}, "satisfied = false", false},
+	{"issue", Filter{IssueID: ptr(3)}, models.Report{IssueID: ptr(3)}, "issue_id = 3", true},
+	{"other issue", Filter{IssueID: ptr(3)}, models.Report{IssueID: ptr(4)}, "issue_id = 3", false},
+	{"issue NULL", Filter{IssueID: ptr(3)}, models.Report{}, "issue_id = 3", false},
+	{"from inclusive", Filter{From: ptr(matchTime)}, reportAt(matchTime), "created_at >= '2024-01-15 12:00:00'", true},
+	{"before from", Filter{From: ptr(matchTime)}, reportAt(matchTime.Add(-time.Second)), "created_at >= '2024-01-15 12:00:00'", false},
+	{"to exclusive", Filter{To: ptr(matchTime)}, reportAt(matchTime), "created_at < '2024-01-15 12:00:00'", false},
+	{"before to", Filter{To: ptr(matchTime)}, reportAt(matchTime.Add(-time.Second)), "created_at < '2024-01-15 12:00:00'", true},
+	{"metadata string", Filter{Metadata: map[string]string{"page": "/checkout"}}, models.Report{Metadata: &matchMetadata}, "(metadata->>'page') = '/checkout'", true},
+	{"metadata number", Filter{Metadata: map[string]string{"build": "42"}}, models.Report{Metadata: &matchMetadata}, "(metadata->>'build') = '42'", true},
+	{"metadata boolean", Filter{Metadata: map[string]string{"beta": "true"}}, models.Report{Metadata: &matchMetadata}, "(metadata->>'beta') = 'true'", true},
+	{"metadata array", Filter{Metadata: map[string]string{"tags": `["a"]`}}, models.Report{Metadata: &matchMetadata}, `(metadata->>'tags') = '["a"]'`, true},
+	{"metadata null", Filter{Metadata: map[string]string{"empty": "null"}}, models.Report{Metadata: &matchMetadata}, "(metadata->>'empty') = 'null'", false},
+	{"metadata missing key", Filter{Metadata: map[string]string{"app": "x"}}, models.Report{Metadata: &matchMetadata}, "(metadata->>'app') = 'x'", false},
+	{"metadata NULL", Filter{Metadata: map[string]string{"page": "/checkout"}}, models.Report{}, "(metadata->>'page') = '/checkout'", false},
+	{"comment", Filter{Comment: "Slow"}, models.Report{Comment: "checkout is slow"}, "comment ILIKE '%Slow%'", true},
+	{"other comment", Filter{Comment: "slow"}, models.Report{Comment: "checkout is fast"}, "comment ILIKE '%slow%'", false},
+	{"comment wildcards", Filter{Comment: "100%_"}, models.Report{Comment: "100%_ done"}, `comment ILIKE '%100\%\_%'`, true},
+}
+
+func reportAt(t time.Time) models.Report {
+	return models.Report{Model: gorm.Model{CreatedAt: t}}
+}
+
+// TestFilterMatches checks that Matches selects reports like the SQL generated by Apply
+func TestFilterMatches(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range filterMatchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt := tt.filter.Apply(db.Model(&models.Report{})).Find(&[]models.Report{}).Statement
+			sql := db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)
+			_, where, _ := strings.Cut(sql, " WHERE ")
+			want := `"reports"."deleted_at" IS NULL`
+			if tt.wantSQL != "" {
+				want = tt.wantSQL + " AND " + want
+			}
+			if where != want {
+				t.Errorf("got SQL condition %s, want %s", where, want)
+			}
+
+			if got := tt.filter.Matches(tt.report); got != tt.want {
+				t.Errorf("got match %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
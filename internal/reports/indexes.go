@@ -0,0 +1,50 @@
+package reports
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+const metadataIndexPrefix = "idx_reports_metadata_"
+
+// SyncMetadataIndexes creates an expression index for every promoted metadata key
+// and drops indexes of keys which are no longer promoted
+func SyncMetadataIndexes(db *gorm.DB, keys []string) error {
+	for _, key := range keys {
+		if !ValidMetadataKey(key) {
+			return fmt.Errorf("invalid promoted metadata key %q", key)
+		}
+	}
+
+	var existing []string
+	err := db.Raw("SELECT indexname FROM pg_indexes WHERE tablename = 'reports' AND indexname LIKE ?", metadataIndexPrefix+"%").
+		Scan(&existing).Error
+	if err != nil {
+		return err
+	}
+
+	for _, index := range existing {
+		if !slices.Contains(keys, index[len(metadataIndexPrefix):]) {
+			if err := db.Exec(fmt.Sprintf("DROP INDEX IF EXISTS %q", index)).Error; err != nil {
+				return err
+			}
+			slog.Warn("Dropped index of metadata key no longer promoted", "index", index)
+		}
+	}
+
+	for _, key := range keys {
+		index := metadataIndexPrefix + key
+		if slices.Contains(existing, index) {
+			continue
+		}
+		if err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %q ON reports (%s)", index, MetadataExpr(key))).Error; err != nil {
+			return err
+		}
+		slog.Info("Created index for promoted metadata key", "metadataKey", key, "index", index)
+	}
+
+	return nil
+}
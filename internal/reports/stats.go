@@ -0,0 +1,95 @@
+package reports
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Stats holds aggregated satisfaction numbers, optionally for a single group
+type Stats struct {
+	Group     *string
+	Total     int64
+	Satisfied int64
+}
+
+// Ratio returns the share of satisfied reports, or 0 if there are none
+func (s Stats) Ratio() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Satisfied) / float64(s.Total)
+}
+
+// GroupByExpr translates a user-facing grouping ("issue", "satisfied", "token" or "metadata.<key>")
+// into a SQL expression. An empty grouping returns an empty expression.
+func GroupByExpr(groupBy string) (string, error) {
+	switch groupBy {
+	case "":
+		return "", nil
+	case "issue":
+		return "issue_id::text", nil
+	case "satisfied":
+		return "satisfied::text", nil
+	case "token":
+		return "token_label", nil
+	}
+
+	key, ok := strings.CutPrefix(groupBy, metadataPrefix)
+	if !ok || !ValidMetadataKey(key) {
+		return "", fmt.Errorf("invalid grouping %q, expected 'issue', 'satisfied', 'token' or 'metadata.<key>'", groupBy)
+	}
+	return MetadataExpr(key), nil
+}
+
+// Bucket holds the stats of reports created within an interval starting at Start
+type Bucket struct {
+	Start time.Time
+	Stats
+}
+
+// Intervals which time series can be bucketed by
+var Intervals = []string{"hour", "day", "week", "month"}
+
+// GetTimeSeries aggregates the reports matching the filter by creation time, truncated to the interval.
+// Buckets without reports are omitted.
+func GetTimeSeries(db *gorm.DB, f Filter, interval string) ([]Bucket, error) {
+	if !slices.Contains(Intervals, interval) {
+		return nil, fmt.Errorf("invalid interval %q, expected one of %s", interval, strings.Join(Intervals, ", "))
+	}
+
+	var buckets []Bucket
+	err := f.Apply(db.Model(&models.Report{})).
+		Select("date_trunc(?, created_at) AS start, COUNT(*) AS total, COUNT(*) FILTER (WHERE satisfied) AS satisfied", interval).
+		Group("start").
+		Order("start").
+		Scan(&buckets).Error
+	return buckets, err
+}
+
+// GetStats aggregates the reports matching the filter, grouped by groupBy (see GroupByExpr).
+// Groups are ordered by report count, largest first.
+func GetStats(db *gorm.DB, f Filter, groupBy string) ([]Stats, error) {
+	expr, err := GroupByExpr(groupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	q := f.Apply(db.Model(&models.Report{}))
+
+	var stats []Stats
+	if expr == "" {
+		err = q.Select("NULL AS \"group\", COUNT(*) AS total, COUNT(*) FILTER (WHERE satisfied) AS satisfied").
+			Scan(&stats).Error
+	} else {
+		err = q.Select(expr + " AS \"group\", COUNT(*) AS total, COUNT(*) FILTER (WHERE satisfied) AS satisfied").
+			Group(expr).
+			Order("total DESC").
+			Scan(&stats).Error
+	}
+	return stats, err
+}
@@ -0,0 +1,67 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of signed requests
+const (
+	HeaderClient    = "X-Feedback-Client"
+	HeaderTimestamp = "X-Feedback-Timestamp"
+	HeaderNonce     = "X-Feedback-Nonce"
+	HeaderSignature = "X-Feedback-Signature"
+)
+
+const (
+	MinNonceLength = 16
+	MaxNonceLength = 128
+)
+
+// StringToSign returns what is signed: the method, the path with the query string, the Unix timestamp,
+// the nonce and the hex SHA-256 of the body, each on its own line
+func StringToSign(method string, uri string, timestamp int64, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return fmt.Sprintf("%s\n%s\n%d\n%s\n%s", method, uri, timestamp, nonce, hex.EncodeToString(bodyHash[:]))
+}
+
+// Sign returns the hex HMAC-SHA256 of a request
+func Sign(secret []byte, method string, uri string, timestamp int64, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(StringToSign(method, uri, timestamp, nonce, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest adds the signature headers to a request of a client, for Go clients of the API
+func SignRequest(req *http.Request, client string, secret []byte) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	random := make([]byte, 18)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(random)
+	timestamp := time.Now().Unix()
+
+	req.Header.Set(HeaderClient, client)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, Sign(secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body))
+	return nil
+}
@@ -0,0 +1,76 @@
+package signing
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStringToSign(t *testing.T) {
+	got := StringToSign("POST", "/v1/submit/report?x=1", 1760000000, "3q2-7wE4TnKq1Zb8Yw0cRm", []byte("{}"))
+	// echo -n '{}' | sha256sum
+	want := "POST\n/v1/submit/report?x=1\n1760000000\n3q2-7wE4TnKq1Zb8Yw0cRm\n44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSign(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	base := Sign(secret, "POST", "/v1/submit/report", 1760000000, "3q2-7wE4TnKq1Zb8Yw0cRm", []byte("{}"))
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{"other secret", Sign([]byte("fedcba9876543210fedcba9876543210"), "POST", "/v1/submit/report", 1760000000, "3q2-7wE4TnKq1Zb8Yw0cRm", []byte("{}"))},
+		{"other method", Sign(secret, "PATCH", "/v1/submit/report", 1760000000, "3q2-7wE4TnKq1Zb8Yw0cRm", []byte("{}"))},
+		{"other path", Sign(secret, "POST", "/v1/submit/report?x=1", 1760000000, "3q2-7wE4TnKq1Zb8Yw0cRm", []byte("{}"))},
+		{"other timestamp", Sign(secret, "POST", "/v1/submit/report", 1760000001, "3q2-7wE4TnKq1Zb8Yw0cRm", []byte("{}"))},
+		{"other nonce", Sign(secret, "POST", "/v1/submit/report", 1760000000, "4q2-7wE4TnKq1Zb8Yw0cRm", []byte("{}"))},
+		{"other body", Sign(secret, "POST", "/v1/submit/report", 1760000000, "3q2-7wE4TnKq1Zb8Yw0cRm", []byte(`{"a":1}`))},
+	}
+
+	if len(base) != 64 {
+		t.Fatalf("got signature %q, want 64 hex characters", base)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.signature == base {
+				t.Errorf("got the same signature %q", base)
+			}
+		})
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	req := httptest.NewRequest("POST", "/v1/submit/report", strings.NewReader(`{"satisfied":true}`))
+	if err := SignRequest(req, "billing", secret); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"satisfied":true}` {
+		t.Errorf("got body %q after signing", body)
+	}
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := req.Header.Get(HeaderNonce)
+	if len(nonce) < MinNonceLength || len(nonce) > MaxNonceLength {
+		t.Errorf("got nonce %q of length %d", nonce, len(nonce))
+	}
+	if got := req.Header.Get(HeaderClient); got != "billing" {
+		t.Errorf("got client %q", got)
+	}
+	if got, want := req.Header.Get(HeaderSignature), Sign(secret, "POST", "/v1/submit/report", timestamp, nonce, body); got != want {
+		t.Errorf("got signature %q, want %q", got, want)
+	}
+}
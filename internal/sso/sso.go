@@ -0,0 +1,257 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Stogas/feedback-api/internal/apikeys"
+	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var ErrNoRole = errors.New("none of the user's groups is mapped to a role")
+
+// User is an identity provider user logged in to the admin UI
+type User struct {
+	Subject string
+	// human readable, for logs and the UI
+	Name string
+	Role string
+}
+
+// Provider logs users in with the OpenID Connect authorization code flow
+type Provider struct {
+	conf config.OIDCConfig
+	// group or role claim value -> admin role
+	roles map[string]string
+	// may be rotated while running, conf.ClientSecret is only the initial one
+	clientSecret atomic.Pointer[string]
+
+	// used for requests to the identity provider, http.DefaultClient if nil
+	client *http.Client
+
+	mu sync.Mutex
+	// nil until the provider configuration is discovered
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	provider *oidc.Provider
+}
+
+// NewProvider validates the configuration. The provider configuration is discovered on first use,
+// so that an unreachable identity provider doesn't prevent starting.
+// Requests to the identity provider use transport, or the default one if nil.
+func NewProvider(conf config.OIDCConfig, transport http.RoundTripper) (*Provider, error) {
+	if conf.ClientID == "" || conf.RedirectURL == "" {
+		return nil, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required")
+	}
+	roles := make(map[string]string, len(conf.RoleMapping))
+	for _, mapping := range conf.RoleMapping {
+		group, role, ok := strings.Cut(mapping, "=")
+		if !ok || group == "" || !apikeys.ValidRole(role) {
+			return nil, fmt.Errorf("invalid OIDC role mapping %q, expected <group>=<%s>", mapping, strings.Join(apikeys.Roles, "|"))
+		}
+		roles[group] = role
+	}
+	if len(roles) == 0 {
+		return nil, errors.New("OIDC_ROLE_MAPPING is required, no one could log in without it")
+	}
+	if !slices.Contains(conf.Scopes, oidc.ScopeOpenID) {
+		conf.Scopes = append([]string{oidc.ScopeOpenID}, conf.Scopes...)
+	}
+	p := &Provider{conf: conf, roles: roles}
+	p.SetClientSecret(conf.ClientSecret)
+	if transport != nil {
+		p.client = &http.Client{Transport: transport}
+	}
+	return p, nil
+}
+
+// SetClientSecret changes the client secret used by logins finished from now on
+func (p *Provider) SetClientSecret(secret string) {
+	p.clientSecret.Store(&secret)
+}
+
+// clientContext makes the OIDC and OAuth2 libraries use the provider's HTTP client
+func (p *Provider) clientContext(ctx context.Context) context.Context {
+	if p.client == nil {
+		return ctx
+	}
+	return oidc.ClientContext(ctx, p.client)
+}
+
+// Discover fetches the provider configuration if it wasn't yet
+func (p *Provider) Discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return nil
+	}
+	// also used by the verifier to fetch the provider's keys
+	ctx = p.clientContext(ctx)
+
+	discoveryURL := p.conf.IssuerURL
+	if p.conf.DiscoveryURL != "" {
+		discoveryURL = p.conf.DiscoveryURL
+		ctx = oidc.InsecureIssuerURLContext(ctx, p.conf.IssuerURL)
+	}
+	provider, err := oidc.NewProvider(ctx, discoveryURL)
+	if err != nil {
+		return fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+
+	p.provider = provider
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.conf.ClientID})
+	p.oauth2 = &oauth2.Config{
+		ClientID:    p.conf.ClientID,
+		Endpoint:    provider.Endpoint(),
+		RedirectURL: p.conf.RedirectURL,
+		Scopes:      p.conf.Scopes,
+	}
+	return nil
+}
+
+// Login holds the values of a started login, which must be kept by the browser until the callback
+type Login struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// Start begins a login, returning the URL to redirect the browser to
+func (p *Provider) Start(ctx context.Context) (string, Login, error) {
+	if err := p.Discover(ctx); err != nil {
+		return "", Login{}, err
+	}
+	login := Login{State: random(), Nonce: random(), Verifier: oauth2.GenerateVerifier()}
+	url := p.oauth2.AuthCodeURL(login.State, oidc.Nonce(login.Nonce), oauth2.S256ChallengeOption(login.Verifier))
+	return url, login, nil
+}
+
+// Finish exchanges the code the browser was redirected back with, returning the logged in user
+func (p *Provider) Finish(ctx context.Context, login Login, code string) (User, error) {
+	var user User
+	if err := p.Discover(ctx); err != nil {
+		return user, err
+	}
+	ctx = p.clientContext(ctx)
+
+	oauth2Config := *p.oauth2
+	oauth2Config.ClientSecret = *p.clientSecret.Load()
+	token, err := oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return user, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return user, errors.New("token response has no ID token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return user, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return user, errors.New("ID token nonce doesn't match")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return user, err
+	}
+	groups, found := claimValues(claims, p.conf.RolesClaim)
+	// some providers only return groups from the userinfo endpoint
+	if !found {
+		if groups, err = p.userInfoGroups(ctx, token, idToken.Subject); err != nil {
+			return user, err
+		}
+	}
+
+	user.Subject = idToken.Subject
+	user.Name = idToken.Subject
+	for _, claim := range []string{"email", "preferred_username", "name"} {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			user.Name = name
+			break
+		}
+	}
+	user.Role = p.role(groups)
+	if user.Role == "" {
+		return user, ErrNoRole
+	}
+	return user, nil
+}
+
+// userInfoGroups fetches the groups or roles of the user from the userinfo endpoint
+func (p *Provider) userInfoGroups(ctx context.Context, token *oauth2.Token, subject string) ([]string, error) {
+	userInfo, err := p.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch userinfo: %w", err)
+	}
+	if userInfo.Subject != subject {
+		return nil, errors.New("userinfo subject doesn't match the ID token")
+	}
+	var claims map[string]any
+	if err := userInfo.Claims(&claims); err != nil {
+		return nil, err
+	}
+	groups, _ := claimValues(claims, p.conf.RolesClaim)
+	return groups, nil
+}
+
+// role returns the highest role any of the groups is mapped to
+func (p *Provider) role(groups []string) string {
+	highest := -1
+	for _, group := range groups {
+		if role, ok := p.roles[group]; ok {
+			highest = max(highest, slices.Index(apikeys.Roles, role))
+		}
+	}
+	if highest == -1 {
+		return ""
+	}
+	return apikeys.Roles[highest]
+}
+
+// claimValues returns the string values of a claim, which may be nested (e.g. "realm_access.roles")
+func claimValues(claims map[string]any, path string) ([]string, bool) {
+	var value any = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}, true
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values, true
+	}
+	return nil, true
+}
+
+func random() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,92 @@
+package sso
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Stogas/feedback-api/internal/config"
+)
+
+func TestNewProviderRoleMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping []string
+		wantErr bool
+	}{
+		{name: "valid", mapping: []string{"feedback-admins=admin", "support=reader"}},
+		{name: "missing", mapping: nil, wantErr: true},
+		{name: "unknown role", mapping: []string{"feedback-admins=root"}, wantErr: true},
+		{name: "without group", mapping: []string{"=admin"}, wantErr: true},
+		{name: "without separator", mapping: []string{"admin"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewProvider(config.OIDCConfig{ClientID: "feedback-api", RedirectURL: "http://localhost/ui/oidc/callback", RoleMapping: tt.mapping}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProviderRole(t *testing.T) {
+	p, err := NewProvider(config.OIDCConfig{
+		ClientID:    "feedback-api",
+		RedirectURL: "http://localhost/ui/oidc/callback",
+		RoleMapping: []string{"feedback-admins=admin", "support=reader", "analysts=exporter"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   string
+	}{
+		{"no groups", nil, ""},
+		{"unmapped groups", []string{"developers"}, ""},
+		{"one group", []string{"support"}, "reader"},
+		{"highest role wins", []string{"support", "feedback-admins", "analysts"}, "admin"},
+		{"mapped and unmapped groups", []string{"developers", "analysts"}, "exporter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.role(tt.groups); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimValues(t *testing.T) {
+	claims := map[string]any{
+		"groups":       []any{"support", 42, "analysts"},
+		"role":         "admin",
+		"realm_access": map[string]any{"roles": []any{"feedback-admins"}},
+	}
+
+	tests := []struct {
+		path   string
+		want   []string
+		wantOK bool
+	}{
+		{"groups", []string{"support", "analysts"}, true},
+		{"role", []string{"admin"}, true},
+		{"realm_access.roles", []string{"feedback-admins"}, true},
+		{"realm_access", nil, true},
+		{"missing", nil, false},
+		{"role.nested", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := claimValues(claims, tt.path)
+			if ok != tt.wantOK || !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/Stogas/feedback-api/internal/models"
+)
+
+const (
+	EventReportCreated = "report.created"
+	EventReportUpdated = "report.updated"
+)
+
+// how many events a subscriber may lag behind before it's disconnected
+const subscriberBuffer = 64
+
+// Event is a change of a report, as stored after the change
+type Event struct {
+	Type   string
+	Report models.Report
+}
+
+// Broadcaster fans out events to all current subscribers of this process
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving all events published from now on, and a function to unsubscribe.
+// The channel is closed when the subscriber is unsubscribed, falls behind or the broadcaster is closed.
+func (b *Broadcaster) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(ch)
+	}
+}
+
+// Publish sends an event to all subscribers without blocking.
+// Subscribers which don't keep up are disconnected rather than silently missing events.
+func (b *Broadcaster) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			b.remove(ch)
+		}
+	}
+}
+
+// Close disconnects all subscribers, e.g. so that open streams don't block a graceful shutdown
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		b.remove(ch)
+	}
+	b.closed = true
+}
+
+// remove must be called with the lock held
+func (b *Broadcaster) remove(ch chan Event) {
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"testing"
+)
+
+// drain returns the events buffered in a channel, and whether it was closed
+func drain(ch <-chan Event) ([]Event, bool) {
+	var events []Event
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return events, true
+			}
+			events = append(events, e)
+		default:
+			return events, false
+		}
+	}
+}
+
+func TestBroadcaster(t *testing.T) {
+	tests := []struct {
+		name        string
+		published   int
+		unsubscribe bool
+		close       bool
+		wantEvents  int
+		wantClosed  bool
+	}{
+		{name: "receives events", published: 3, wantEvents: 3},
+		{name: "buffer full", published: subscriberBuffer, wantEvents: subscriberBuffer},
+		{name: "falls behind", published: subscriberBuffer + 1, wantEvents: subscriberBuffer, wantClosed: true},
+		{name: "unsubscribed", published: 1, unsubscribe: true, wantEvents: 0, wantClosed: true},
+		{name: "closed", published: 1, close: true, wantEvents: 0, wantClosed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBroadcaster()
+			ch, unsubscribe := b.Subscribe()
+			if tt.unsubscribe {
+				unsubscribe()
+			}
+			if tt.close {
+				b.Close()
+			}
+			for i := 0; i < tt.published; i++ {
+				b.Publish(Event{Type: EventReportCreated})
+			}
+
+			events, closed := drain(ch)
+			if len(events) != tt.wantEvents || closed != tt.wantClosed {
+				t.Errorf("got %d events and closed %v, want %d and %v", len(events), closed, tt.wantEvents, tt.wantClosed)
+			}
+			// unsubscribing after being disconnected must not panic
+			unsubscribe()
+		})
+	}
+}
+
+func TestSubscribeAfterClose(t *testing.T) {
+	b := NewBroadcaster()
+	b.Close()
+
+	ch, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	if _, closed := drain(ch); !closed {
+		t.Error("expected a closed channel")
+	}
+}
@@ -0,0 +1,80 @@
+package ui
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/reports"
+)
+
+//go:embed templates/*.html
+var templates embed.FS
+
+// Templates parses the pages of the admin UI. Each page is a template named after its file, e.g. "reports.html".
+func Templates() (*template.Template, error) {
+	return template.New("ui").Funcs(template.FuncMap{
+		"percent":  func(ratio float64) string { return fmt.Sprintf("%.1f%%", 100*ratio) },
+		"datetime": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04") },
+		"deref": func(v any) any {
+			switch p := v.(type) {
+			case *bool:
+				if p != nil {
+					return *p
+				}
+			case *int:
+				if p != nil {
+					return *p
+				}
+			}
+			return nil
+		},
+	}).ParseFS(templates, "templates/*.html")
+}
+
+const (
+	chartWidth  = 800
+	chartHeight = 200
+)
+
+// Chart is an SVG bar chart of the satisfaction ratio over time, with bar opacity showing the report count
+type Chart struct {
+	Width  int
+	Height int
+	Bars   []Bar
+}
+
+type Bar struct {
+	X, Y, Width, Height float64
+	Opacity             float64
+	Label               string
+}
+
+// NewChart lays out the buckets of a time series as bars
+func NewChart(buckets []reports.Bucket) Chart {
+	c := Chart{Width: chartWidth, Height: chartHeight}
+	if len(buckets) == 0 {
+		return c
+	}
+
+	var maxTotal int64
+	for _, b := range buckets {
+		maxTotal = max(maxTotal, b.Total)
+	}
+
+	slot := float64(chartWidth) / float64(len(buckets))
+	for i, b := range buckets {
+		height := b.Ratio() * chartHeight
+		c.Bars = append(c.Bars, Bar{
+			X:      float64(i)*slot + slot*0.1,
+			Y:      chartHeight - height,
+			Width:  slot * 0.8,
+			Height: height,
+			// buckets with few reports are fainter, as their ratio is less meaningful
+			Opacity: 0.3 + 0.7*float64(b.Total)/float64(maxTotal),
+			Label:   fmt.Sprintf("%s: %.1f%% of %d reports satisfied", b.Start.UTC().Format("2006-01-02 15:04"), 100*b.Ratio(), b.Total),
+		})
+	}
+	return c
+}
@@ -8,16 +8,16 @@ import (
 	"github.com/Stogas/feedback-api/internal/config"
 )
 
+// logLevel can be changed by a config reload
+var logLevel = new(slog.LevelVar)
+
 func initLogger(conf config.LogsConfig) {
 	var handler slog.Handler
 
-	level := slog.LevelInfo
-	if conf.Debug {
-		level = slog.LevelDebug
-	}
+	setLogLevel(conf)
 	opts := &slog.HandlerOptions{
 		AddSource: conf.Source,
-		Level:     level,
+		Level:     logLevel,
 	}
 
 	if conf.JSON {
@@ -28,6 +28,14 @@ func initLogger(conf config.LogsConfig) {
 	slog.SetDefault(slog.New(handler))
 }
 
+func setLogLevel(conf config.LogsConfig) {
+	level := slog.LevelInfo
+	if conf.Debug {
+		level = slog.LevelDebug
+	}
+	logLevel.Set(level)
+}
+
 var contextLogger = slog.Logger{}
 
 func getLogger(ctx context.Context) *slog.Logger {
@@ -1,15 +1,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/Depado/ginprom"
+	"github.com/Stogas/feedback-api/internal/alerting"
 	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/Stogas/feedback-api/internal/digest"
+	"github.com/Stogas/feedback-api/internal/stream"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/propagation"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 )
 
+// set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func init() {
 	// loads values from .env into the system
 	if err := godotenv.Load(); err != nil {
@@ -18,41 +33,103 @@ func init() {
 }
 
 func main() {
-	conf := config.New()
+	// commands log to stderr, keeping stdout for their output
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	conf, values := loadConfig()
 
 	gin.SetMode(gin.ReleaseMode)
 	var globalMiddlewares []gin.HandlerFunc
 
 	// tracing
+	var tracerClose func(context.Context) error
+	// of outgoing HTTP requests, the default one if nil
+	var transport http.RoundTripper
 	if conf.Tracing.Enabled {
-		tracerClose, b3 := initTracer(conf.Tracing)
-		defer tracerClose()
-		globalMiddlewares = append(globalMiddlewares, otelgin.Middleware("feedback-api", otelgin.WithPropagators(b3)))
+		var propagator propagation.TextMapPropagator
+		tracerClose, propagator = initTracer(conf.Tracing)
+		globalMiddlewares = append(globalMiddlewares, otelgin.Middleware("feedback-api", otelgin.WithPropagators(propagator)))
+		transport = newHTTPTransport(propagator)
 	}
 
 	// logging
 	initLogger(conf.Logs)
-	var l gin.HandlerFunc
-	if conf.Logs.JSON {
-		if conf.Tracing.Enabled {
-			l = traceLogMiddleware()
-		} else {
-			l = regularLogMiddleware()
-		}
-	} else {
-		l = gin.Logger()
+	globalMiddlewares = append(globalMiddlewares, logMiddleware(conf.Logs, conf.Tracing.Enabled))
+
+	// reloads are only handled once started, until then SIGHUP must not terminate the process
+	signal.Ignore(syscall.SIGHUP)
+
+	// database, which is connected to in the background so that readiness can be reported meanwhile
+	db := initDB(conf.Database, conf.Tracing.Enabled)
+	ready := newReadiness(db, conf.API.ReadinessTimeout)
+	dbMiddleware := createDBMiddleware(db, ready)
+	live, err := newLiveConfig(conf.API)
+	if err != nil {
+		slog.Error("Invalid CORS configuration", "error", err)
+		panic("invalid CORS configuration")
 	}
-	globalMiddlewares = append(globalMiddlewares, l)
+	engine := initAlerting(conf.Alerting, conf.SMTP, db, live, transport)
+	digests := initDigests(conf.Digest, conf.SMTP, db, live)
+	ssoProvider := startSSO(conf.OIDC, conf.API, live, transport)
 
-	// database
-	db := initDB(conf.Database, conf.Tracing.Enabled, conf.IssueTypes)
-	dbMiddleware := createDBMiddleware(db)
+	// report event stream
+	events := &reportEvents{broadcaster: stream.NewBroadcaster(), notify: conf.API.StreamPostgresNotify}
 
 	// metrics
 	rMetrics, p := initMetrics(globalMiddlewares)
-	// start metrics listener in the background
-	go startMetrics(rMetrics, conf.Metrics)
-	globalMiddlewares = append(globalMiddlewares, p.Instrument(), metricsMiddleware(p))
+	exportSubmitTokenExpiry(conf.API.SubmitTokens)
+	exportDBStats(db)
+	metricsServer := startMetrics(rMetrics, conf.Metrics)
+	globalMiddlewares = append(globalMiddlewares, p.Instrument(), metricsMiddleware(p), eventsMiddleware(events))
+
+	w := newWorkers()
+	startWorkers(w, conf, values, db, ready, live, engine, digests, events, p)
+
+	apiServer := startAPI(conf.API, live, ready, globalMiddlewares, dbMiddleware, events, digests, ssoProvider)
+
+	waitForShutdownSignal()
+	shutdown(conf.Shutdown, ready, apiServer, w, metricsServer, tracerClose, db)
+}
 
-	startAPI(conf.API, globalMiddlewares, dbMiddleware)
+// loadConfig reads the configuration along with its resolved values, logging each error of an invalid one before panicking
+func loadConfig() (*config.Config, []config.Value) {
+	conf, values, err := config.Load()
+	var errs config.Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			slog.Error("Invalid configuration", "error", e)
+		}
+		panic("invalid configuration")
+	} else if err != nil {
+		panic(err)
+	}
+	return conf, values
+}
+
+// startWorkers prepares the database in the background, then starts the background workers,
+// which all use the database, and the config reloader
+func startWorkers(w *workers, conf *config.Config, values []config.Value, db *gorm.DB, ready *readiness, live *liveConfig,
+	engine *alerting.Engine, digests *digest.Mailer, events *reportEvents, p *ginprom.Prometheus) {
+	w.start(func(ctx context.Context) {
+		if !prepareDB(ctx, db, conf.Database, conf.Tracing.Enabled, conf.IssueTypes, conf.API.IssueTypesMode, ready) {
+			return
+		}
+
+		w.start(func(ctx context.Context) { purgeIdempotencyKeys(ctx, db, conf.API.IdempotencyKeyTTL) })
+		// signing clients may be added by a config reload
+		w.start(func(ctx context.Context) { purgeSignatureNonces(ctx, db, live) })
+		if engine != nil {
+			w.start(func(ctx context.Context) { engine.Run(ctx, conf.Alerting.EvaluationInterval) })
+		}
+		if digests != nil {
+			w.start(digests.Run)
+		}
+		if events.notify {
+			w.start(func(ctx context.Context) { listenReportEvents(ctx, conf.Database, db, events.broadcaster) })
+		}
+		startReloader(w, conf, values, live, db, p)
+		slog.Info("Ready to serve requests")
+	})
 }
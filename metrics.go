@@ -3,12 +3,25 @@ package main
 import (
 	"fmt"
 	"log/slog"
+	"net/http"
 
 	"github.com/Depado/ginprom"
 	"github.com/Stogas/feedback-api/internal/config"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
 )
 
+// submitTokenExpiry isn't a ginprom custom gauge so that it can be reset, dropping tokens removed by a reload.
+// It's named like the custom metrics, in ginprom's default namespace
+var submitTokenExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "gin",
+	Subsystem: "feedbackapi",
+	Name:      "submit_token_expiry_timestamp_seconds",
+	Help:      "When each submit token expires, as a Unix timestamp. Tokens without an expiry are not exported",
+}, []string{"token"})
+
 func initMetrics(m []gin.HandlerFunc) (*gin.Engine, *ginprom.Prometheus) {
 	r := gin.New()
 
@@ -25,14 +38,52 @@ func initMetrics(m []gin.HandlerFunc) (*gin.Engine, *ginprom.Prometheus) {
 	)
 
 	p.AddCustomCounter("reports_total", "Counts how many good/bad reports are received successfully. Note that this only counts new submittions, not updates", []string{"satisfied"})
+	p.AddCustomCounter("submit_token_requests_total", "Counts requests to the submission routes by submit token label and whether the token was accepted, expired or invalid", []string{"token", "result"})
+	p.AddCustomCounter("config_reloads_total", "Counts config reloads by whether they succeeded or failed, in which case the previous configuration is kept", []string{"result"})
+	p.AddCustomGauge("config_last_reload_success_timestamp_seconds", "When the configuration was last loaded successfully, as a Unix timestamp", []string{})
+	// ginprom uses the default registry
+	prometheus.MustRegister(submitTokenExpiry)
 
 	return r, p
 }
 
-func startMetrics(r *gin.Engine, conf config.MetricsConfig) {
+// exportSubmitTokenExpiry sets the expiry metric of submit tokens, to alert before a token expires,
+// and replaces the values of the previous tokens
+func exportSubmitTokenExpiry(tokens []config.SubmitToken) {
+	submitTokenExpiry.Reset()
+	for _, token := range tokens {
+		if token.ExpiresAt.IsZero() {
+			continue
+		}
+		submitTokenExpiry.WithLabelValues(token.Label).Set(float64(token.ExpiresAt.Unix()))
+	}
+}
+
+// exportDBStats exports the stats of the database connection pool, as go_sql_* metrics
+func exportDBStats(db *gorm.DB) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		slog.Error("Failed to get database connection pool", "error", err)
+		return
+	}
+	// ginprom uses the default registry
+	if err := prometheus.Register(collectors.NewDBStatsCollector(sqlDB, "feedbackapi")); err != nil {
+		slog.Error("Failed to register database connection pool metrics", "error", err)
+	}
+}
+
+// startMetrics runs the metrics listener in the background, returning its server for shutting it down
+func startMetrics(r *gin.Engine, conf config.MetricsConfig) *http.Server {
 	slog.Info("Starting Prometheus exporter", "host", conf.Host, "port", conf.Port)
 
-	if err := r.Run(fmt.Sprintf("%s:%v", conf.Host, conf.Port)); err != nil {
-		slog.Error("Failed to run metrics exporter", "error", err)
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%v", conf.Host, conf.Port),
+		Handler: r.Handler(),
 	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Failed to run metrics exporter", "error", err)
+		}
+	}()
+	return srv
 }
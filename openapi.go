@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/Stogas/feedback-api/internal/openapi"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func initOpenAPI() (*openapi3.T, []byte) {
+	doc, err := openapi.New(version)
+	if err != nil {
+		slog.Error("Failed to generate OpenAPI document", "error", err)
+		panic("failed to generate OpenAPI document")
+	}
+
+	spec, err := json.Marshal(doc)
+	if err != nil {
+		slog.Error("Failed to serialize OpenAPI document", "error", err)
+		panic("failed to serialize OpenAPI document")
+	}
+
+	return doc, spec
+}
+
+func openAPIEndpoint(spec []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", spec)
+	}
+}
+
+// openAPIValidationMiddleware rejects requests not matching the OpenAPI document.
+// Authentication is left to the token middlewares, and routes not described in the document are passed through.
+func openAPIValidationMiddleware(doc *openapi3.T) gin.HandlerFunc {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		slog.Error("Failed to create OpenAPI router", "error", err)
+		panic("failed to create OpenAPI router")
+	}
+
+	// accept exactly the UUIDs accepted when binding requests
+	openapi3.DefineStringFormatCallback("uuid", func(s string) error {
+		_, err := uuid.Parse(s)
+		return err
+	})
+
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		MultiError:         true,
+	}
+
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			if !errors.Is(err, routers.ErrPathNotFound) && !errors.Is(err, routers.ErrMethodNotAllowed) {
+				getLogger(c.Request.Context()).Warn("Failed to find OpenAPI route", "error", err)
+			}
+			c.Next()
+			return
+		}
+
+		err = openapi3filter.ValidateRequest(c.Request.Context(), &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		})
+		if err != nil {
+			abortWithOpenAPIError(c, err)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func abortWithOpenAPIError(c *gin.Context, err error) {
+	p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "Request does not match the OpenAPI specification")
+	for _, e := range flattenErrors(err) {
+		var schemaErr *openapi3.SchemaError
+		var requestErr *openapi3filter.RequestError
+		switch {
+		case errors.As(e, &requestErr) && requestErr.Parameter != nil:
+			message := "has an invalid value"
+			if errors.As(requestErr.Err, &schemaErr) {
+				message = schemaErr.Reason
+			}
+			p.Errors = append(p.Errors, dto.FieldError{
+				Field:   requestErr.Parameter.Name,
+				Code:    "parameter",
+				Message: message,
+			})
+		case errors.As(e, &schemaErr):
+			p.Errors = append(p.Errors, dto.FieldError{
+				Field:   strings.Join(schemaErr.JSONPointer(), "."),
+				Code:    schemaErr.SchemaField,
+				Message: schemaErr.Reason,
+			})
+		case errors.As(e, &requestErr):
+			p.Code = codeInvalidBody
+			p.Type = problemTypePrefix + codeInvalidBody
+			p.Detail = "Request body is not valid JSON or contains malformed values"
+		}
+	}
+	abortWithProblemDetails(c, p)
+}
+
+// flattenErrors unwraps the nested multi-errors returned by openapi3filter
+func flattenErrors(err error) []error {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var flat []error
+		for _, e := range multi {
+			flat = append(flat, flattenErrors(e)...)
+		}
+		return flat
+	}
+	var requestErr *openapi3filter.RequestError
+	// parameter errors are kept whole, as their schema errors don't carry the parameter name
+	if errors.As(err, &requestErr) && requestErr.Parameter == nil && requestErr.Err != nil {
+		if errors.As(requestErr.Err, &multi) {
+			return flattenErrors(multi)
+		}
+		var schemaErr *openapi3.SchemaError
+		if errors.As(requestErr.Err, &schemaErr) {
+			return []error{schemaErr}
+		}
+	}
+	return []error{err}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Stable, machine-readable error codes. These are part of the public API:
+// never change or reuse an existing code, only add new ones.
+const (
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeNotFound           = "not_found"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeInternal           = "internal_error"
+	codeInvalidBody        = "invalid_body"
+	codeValidationFailed   = "validation_failed"
+	codeInvalidQuery       = "invalid_query"
+	codeInvalidIssueID     = "invalid_issue_id"
+	codeReportExists       = "report_already_exists"
+	codeReportNotFound     = "report_not_found"
+	codeDatabaseReadError  = "database_read_error"
+	codeDatabaseWriteError = "database_write_error"
+)
+
+const problemTypePrefix = "urn:feedback-api:problem:"
+
+// useJSONFieldNames makes validation errors refer to fields by their JSON names
+func useJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
+
+func newProblem(c *gin.Context, status int, code string, detail string) dto.Problem {
+	p := dto.Problem{
+		Type:     problemTypePrefix + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+		Code:     code,
+	}
+	if sc := trace.SpanContextFromContext(c.Request.Context()); sc.HasTraceID() {
+		p.TraceID = sc.TraceID().String()
+	}
+	return p
+}
+
+// abortWithProblem stops the middleware chain and responds with an RFC 7807 problem
+func abortWithProblem(c *gin.Context, status int, code string, detail string) {
+	abortWithProblemDetails(c, newProblem(c, status, code, detail))
+}
+
+func abortWithProblemDetails(c *gin.Context, p dto.Problem) {
+	c.Header("Content-Type", dto.ProblemContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// abortWithBindingError translates request binding errors into a problem with field-level details
+func abortWithBindingError(c *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "One or more fields are invalid")
+		p.Errors = fieldErrors(validationErrs)
+		abortWithProblemDetails(c, p)
+	case errors.As(err, &typeErr):
+		p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "One or more fields are invalid")
+		p.Errors = []dto.FieldError{{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("must be of type %s", typeErr.Type),
+		}}
+		abortWithProblemDetails(c, p)
+	default:
+		abortWithProblem(c, http.StatusBadRequest, codeInvalidBody, "Request body is not valid JSON or contains malformed values")
+	}
+}
+
+func fieldErrors(validationErrs validator.ValidationErrors) []dto.FieldError {
+	errs := make([]dto.FieldError, len(validationErrs))
+	for i, fe := range validationErrs {
+		errs[i] = dto.FieldError{
+			Field:   fe.Field(),
+			Code:    fe.Tag(),
+			Message: validationMessage(fe),
+		}
+	}
+	return errs
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		return limitMessage("at most", fe)
+	case "min":
+		return limitMessage("at least", fe)
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	default:
+		return fmt.Sprintf("failed the '%s' validation", fe.Tag())
+	}
+}
+
+// limitMessage describes a min or max limit in what it counts for the field's kind
+func limitMessage(bound string, fe validator.FieldError) string {
+	t := fe.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("must be %s %s characters long", bound, fe.Param())
+	case reflect.Slice, reflect.Array:
+		// raw JSON and other byte slices are limited in size
+		if t.Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("must be %s %s bytes long", bound, fe.Param())
+		}
+		return fmt.Sprintf("must have %s %s items", bound, fe.Param())
+	case reflect.Map:
+		return fmt.Sprintf("must have %s %s items", bound, fe.Param())
+	default:
+		return fmt.Sprintf("must be %s %s", bound, fe.Param())
+	}
+}
+
+func recoveryProblem(c *gin.Context, _ any) {
+	abortWithProblem(c, http.StatusInternalServerError, codeInternal, "Unexpected internal error")
+}
+
+func notFoundProblem(c *gin.Context) {
+	abortWithProblem(c, http.StatusNotFound, codeNotFound, "No such route")
+}
+
+func methodNotAllowedProblem(c *gin.Context) {
+	abortWithProblem(c, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed for this route")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/datatypes"
+)
+
+var testMetadata = datatypes.JSON(`{"page":"/checkout"}`)
+
+var validationMessageTests = []struct {
+	name  string
+	value any
+	want  string
+}{
+	{
+		name: "required",
+		value: struct {
+			Satisfied *bool `json:"satisfied" binding:"required"`
+		}{},
+		want: "is required",
+	},
+	{
+		name: "string",
+		value: struct {
+			Comment string `json:"comment" binding:"max=3"`
+		}{Comment: "abcd"},
+		want: "must be at most 3 characters long",
+	},
+	{
+		name: "JSON",
+		value: struct {
+			Metadata *datatypes.JSON `json:"metadata" binding:"max=4"`
+		}{Metadata: &testMetadata},
+		want: "must be at most 4 bytes long",
+	},
+	{
+		name: "slice",
+		value: struct {
+			Items []string `json:"items" binding:"min=2"`
+		}{Items: []string{"a"}},
+		want: "must have at least 2 items",
+	},
+	{
+		name: "map",
+		value: struct {
+			Labels map[string]string `json:"labels" binding:"max=1"`
+		}{Labels: map[string]string{"a": "1", "b": "2"}},
+		want: "must have at most 1 items",
+	},
+	{
+		name: "number",
+		value: struct {
+			Position int `json:"position" binding:"max=10"`
+		}{Position: 11},
+		want: "must be at most 10",
+	},
+	{
+		name: "other tag",
+		value: struct {
+			Email string `json:"email" binding:"email"`
+		}{Email: "nope"},
+		want: "failed the 'email' validation",
+	},
+}
+
+func TestValidationMessage(t *testing.T) {
+	useJSONFieldNames()
+
+	for _, tt := range validationMessageTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs validator.ValidationErrors
+			if err := binding.Validator.ValidateStruct(tt.value); !errors.As(err, &errs) || len(errs) != 1 {
+				t.Fatalf("expected a single validation error, got %v", err)
+			}
+			if got := validationMessage(errs[0]); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
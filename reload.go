@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Depado/ginprom"
+	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// reloadableSettings are applied on config reload, changes of any other setting are only logged as requiring a restart
+var reloadableSettings = []string{
+	"ISSUE_TYPES",
+	"API_CORS_ORIGINS",
+	"API_SUBMIT_TOKEN",
+	"API_SUBMIT_TOKENS",
+	"API_SUBMIT_SIGNING_KEYS",
+	"API_SUBMIT_SIGNATURE_WINDOW",
+	"LOGS_DEBUG",
+	// used by new connections, existing ones stay open
+	"POSTGRES_PASSWORD",
+	// rotating it logs everyone out of the admin UI
+	"API_ADMIN_UI_SESSION_SECRET",
+	"SMTP_PASSWORD",
+	"OIDC_CLIENT_SECRET",
+	// only if a webhook was set on start, it can't be added or removed by a reload
+	"ALERT_WEBHOOK_URL",
+	// OTLP_HEADERS is added by reloadableOTLPHeaders when exporting with OTLP/gRPC
+}
+
+// submitAuth is what the submission routes accept
+type submitAuth struct {
+	tokens          []config.SubmitToken
+	clients         []config.SigningClient
+	signatureWindow time.Duration
+}
+
+// liveConfig holds the reloadable settings read by middlewares, swapped atomically so that requests in flight keep a consistent view
+type liveConfig struct {
+	submitAuth      atomic.Pointer[submitAuth]
+	cors            atomic.Pointer[gin.HandlerFunc]
+	uiSessionSecret atomic.Pointer[[]byte]
+	// apply rotated secrets to the components holding them, e.g. mail senders
+	secretHooks []func(conf *config.Config)
+}
+
+func newLiveConfig(conf config.APIConfig) (*liveConfig, error) {
+	corsHandler, err := newCORSHandler(conf.CorsOrigins)
+	if err != nil {
+		return nil, err
+	}
+	live := &liveConfig{}
+	live.store(conf, corsHandler)
+	return live, nil
+}
+
+func newCORSHandler(origins []string) (gin.HandlerFunc, error) {
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowOrigins = origins
+	corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, "X-Feedback-Submit-Token", "Authorization", "Idempotency-Key", "If-Match", "If-None-Match")
+	corsConfig.ExposeHeaders = append(corsConfig.ExposeHeaders, "Deprecation", "Sunset", "Link", "Idempotent-Replayed", "ETag")
+	corsConfig.MaxAge = 1 * time.Hour
+	corsConfig.AllowWildcard = true
+	// cors.New panics on an invalid config
+	if err := corsConfig.Validate(); err != nil {
+		return nil, err
+	}
+	return cors.New(corsConfig), nil
+}
+
+func (l *liveConfig) store(conf config.APIConfig, corsHandler gin.HandlerFunc) {
+	l.cors.Store(&corsHandler)
+	l.submitAuth.Store(&submitAuth{
+		tokens:          conf.SubmitTokens,
+		clients:         conf.SubmitSigningClients,
+		signatureWindow: conf.SubmitSignatureWindow,
+	})
+	uiSessionSecret := []byte(conf.AdminUISessionSecret)
+	l.uiSessionSecret.Store(&uiSessionSecret)
+}
+
+// onSecretsReload registers a function applying rotated secrets to a component. Components are set up
+// before the reloader is started, so hooks aren't registered while they may be called.
+func (l *liveConfig) onSecretsReload(hook func(conf *config.Config)) {
+	l.secretHooks = append(l.secretHooks, hook)
+}
+
+func (l *liveConfig) corsMiddleware(c *gin.Context) {
+	(*l.cors.Load())(c)
+}
+
+// reloader re-reads the configuration when the config file changes or on SIGHUP
+type reloader struct {
+	// one reload at a time
+	mu sync.Mutex
+	// resolved values of the applied configuration, to tell what changed
+	values map[string]string
+	// the config file and secret files, which are watched for changes
+	files []string
+	conf  *config.Config
+	live  *liveConfig
+	db    *gorm.DB
+	p     *ginprom.Prometheus
+}
+
+// startReloader handles SIGHUP and watches the config files as background workers, until shutdown
+func startReloader(w *workers, conf *config.Config, values []config.Value, live *liveConfig, db *gorm.DB, p *ginprom.Prometheus) {
+	r := &reloader{values: valueMap(values), files: watchedFiles(values), conf: conf, live: live, db: db, p: p}
+	r.setLastSuccess()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	w.start(func(ctx context.Context) {
+		// SIGHUP is ignored again, rather than terminating the process while it's shutting down
+		defer signal.Ignore(syscall.SIGHUP)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				r.reload("SIGHUP")
+			}
+		}
+	})
+
+	if len(r.files) == 0 || conf.WatchInterval == 0 {
+		return
+	}
+	slog.Info("Watching config files for changes", "files", r.files, "interval", conf.WatchInterval)
+	w.start(func(ctx context.Context) { r.watch(ctx, conf.WatchInterval) })
+}
+
+// watchedFiles returns the config file and the secret files values were read from
+func watchedFiles(values []config.Value) []string {
+	var files []string
+	if path := os.Getenv(config.FileEnvVar); path != "" {
+		files = append(files, path)
+	}
+	for _, v := range values {
+		if v.File != "" && !slices.Contains(files, v.File) {
+			files = append(files, v.File)
+		}
+	}
+	return files
+}
+
+// watch polls the watched files, rather than relying on file system events, which are lost when
+// e.g. a Kubernetes ConfigMap or Secret mount swaps the symlink of its directory
+func (r *reloader) watch(ctx context.Context, interval time.Duration) {
+	last, _ := r.filesHash()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		hash, err := r.filesHash()
+		// a file being replaced may briefly be missing, it's reloaded once it's back
+		if err != nil || hash == last {
+			continue
+		}
+		last = hash
+		r.reload("file")
+	}
+}
+
+func (r *reloader) reload(trigger string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conf, values, err := config.Load()
+	var errs config.Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			slog.Error("Config reload failed, keeping the current configuration", "trigger", trigger, "error", e)
+		}
+		r.countReload("failure")
+		return
+	}
+
+	newValues := valueMap(values)
+	changed, restartRequired := changedSettings(r.values, newValues)
+
+	corsHandler, err := newCORSHandler(conf.API.CorsOrigins)
+	if err != nil {
+		slog.Error("Config reload failed, keeping the current configuration", "trigger", trigger, "error", err)
+		r.countReload("failure")
+		return
+	}
+	// the issue types are synced last, as the only change which may fail after validation
+	if !slices.Equal(conf.IssueTypes, r.conf.IssueTypes) {
+		if err := syncIssueTypes(r.db, conf.IssueTypes, r.conf.API.IssueTypesMode); err != nil {
+			slog.Error("Config reload failed, issue types couldn't be synced", "trigger", trigger, "error", err)
+			r.countReload("failure")
+			return
+		}
+	}
+
+	r.live.store(conf.API, corsHandler)
+	dbPassword.Store(&conf.Database.Password)
+	otlpHeaders.Store(&conf.Tracing.Headers)
+	for _, hook := range r.live.secretHooks {
+		hook(conf)
+	}
+	setLogLevel(conf.Logs)
+	exportSubmitTokenExpiry(conf.API.SubmitTokens)
+
+	// settings requiring a restart keep their current values, so that later reloads compare against what's running
+	for _, name := range restartRequired {
+		newValues[name] = r.values[name]
+	}
+	r.values = newValues
+	r.files = watchedFiles(values)
+	r.conf.IssueTypes = conf.IssueTypes
+
+	slog.Info("Config reloaded", "trigger", trigger, "changed", changed)
+	if len(restartRequired) > 0 {
+		slog.Warn("Changed settings are only applied on restart", "settings", restartRequired)
+	}
+	r.countReload("success")
+	r.setLastSuccess()
+}
+
+func (r *reloader) countReload(result string) {
+	if err := r.p.IncrementCounterValue("config_reloads_total", []string{result}); err != nil {
+		slog.Error("Failed to increment metrics counter", "error", err)
+	}
+}
+
+func (r *reloader) setLastSuccess() {
+	if err := r.p.SetGaugeValue("config_last_reload_success_timestamp_seconds", []string{}, float64(time.Now().Unix())); err != nil {
+		slog.Error("Failed to set config reload metric", "error", err)
+	}
+}
+
+// changedSettings returns the names of the changed settings, split by whether they can be reloaded
+func changedSettings(oldValues, newValues map[string]string) (changed, restartRequired []string) {
+	for _, name := range sortedMapKeys(newValues) {
+		if newValues[name] == oldValues[name] {
+			continue
+		}
+		if slices.Contains(reloadableSettings, name) {
+			changed = append(changed, name)
+		} else {
+			restartRequired = append(restartRequired, name)
+		}
+	}
+	return changed, restartRequired
+}
+
+func valueMap(values []config.Value) map[string]string {
+	m := make(map[string]string, len(values))
+	for _, v := range values {
+		m[v.Name] = v.Value
+	}
+	return m
+}
+
+func sortedMapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// filesHash returns the hash of the content of all watched files
+func (r *reloader) filesHash() ([sha256.Size]byte, error) {
+	r.mu.Lock()
+	files := r.files
+	r.mu.Unlock()
+
+	var sum [sha256.Size]byte
+	h := sha256.New()
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return sum, err
+		}
+		h.Write([]byte(path))
+		h.Write(data)
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
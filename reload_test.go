@@ -0,0 +1,49 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestChangedSettings(t *testing.T) {
+	current := map[string]string{
+		"ISSUE_TYPES":      "bug,idea",
+		"API_CORS_ORIGINS": "*",
+		"LOGS_DEBUG":       "false",
+		"POSTGRES_HOST":    "db",
+	}
+
+	tests := []struct {
+		name                string
+		changes             map[string]string
+		wantChanged         []string
+		wantRestartRequired []string
+	}{
+		{name: "unchanged", changes: nil},
+		{name: "reloadable", changes: map[string]string{"ISSUE_TYPES": "bug", "LOGS_DEBUG": "true"}, wantChanged: []string{"ISSUE_TYPES", "LOGS_DEBUG"}},
+		{name: "requiring a restart", changes: map[string]string{"POSTGRES_HOST": "db2"}, wantRestartRequired: []string{"POSTGRES_HOST"}},
+		{
+			name:                "both",
+			changes:             map[string]string{"API_CORS_ORIGINS": "https://app.example.com", "POSTGRES_HOST": "db2"},
+			wantChanged:         []string{"API_CORS_ORIGINS"},
+			wantRestartRequired: []string{"POSTGRES_HOST"},
+		},
+		{name: "newly set", changes: map[string]string{"API_SUBMIT_TOKENS": "2026-11=abc"}, wantChanged: []string{"API_SUBMIT_TOKENS"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := maps.Clone(current)
+			maps.Copy(values, tt.changes)
+
+			changed, restartRequired := changedSettings(current, values)
+			if !slices.Equal(changed, tt.wantChanged) {
+				t.Errorf("got changed %v, want %v", changed, tt.wantChanged)
+			}
+			if !slices.Equal(restartRequired, tt.wantRestartRequired) {
+				t.Errorf("got restart required %v, want %v", restartRequired, tt.wantRestartRequired)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/config"
+	"gorm.io/gorm"
+)
+
+// workers runs the background workers, which are stopped by canceling their context on shutdown
+type workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newWorkers() *workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workers{ctx: ctx, cancel: cancel}
+}
+
+// start runs a worker in the background, unless shutdown has begun
+func (w *workers) start(run func(ctx context.Context)) {
+	if w.ctx.Err() != nil {
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		run(w.ctx)
+	}()
+}
+
+// stop cancels the workers and waits for them to return, or until ctx is done
+func (w *workers) stop(ctx context.Context) error {
+	w.cancel()
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitForShutdownSignal blocks until SIGINT or SIGTERM is received
+func waitForShutdownSignal() {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	signal.Stop(quit)
+}
+
+// shutdown stops everything in order, so that requests in flight are completed, and their spans exported,
+// before the database connections are closed:
+// readiness fails first, so that load balancers stop routing requests here during the pre-stop delay,
+// then the API listener is drained, the background workers and the metrics listener are stopped, traces are flushed,
+// and finally the database is closed.
+func shutdown(conf config.ShutdownConfig, ready *readiness, api *http.Server, w *workers, metrics *http.Server, tracerClose func(context.Context) error, db *gorm.DB) {
+	ready.shuttingDown.Store(true)
+	if conf.PreStopDelay > 0 {
+		slog.Info("Shutting down, waiting for traffic to stop ...", "preStopDelay", conf.PreStopDelay)
+		time.Sleep(conf.PreStopDelay)
+	}
+
+	slog.Info("Shutting down API listener ...", "timeout", conf.DrainTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), conf.DrainTimeout)
+	if err := api.Shutdown(ctx); err != nil {
+		slog.Error("Requests didn't finish in time, closing their connections", "error", err, "timeout", conf.DrainTimeout)
+		api.Close()
+	} else {
+		slog.Info("API listener exited successfully")
+	}
+	cancel()
+
+	step := func(name string, stop func(ctx context.Context) error) {
+		ctx, cancel := context.WithTimeout(context.Background(), conf.Timeout)
+		defer cancel()
+		if err := stop(ctx); err != nil {
+			slog.Error("Failed to shut down component", "component", name, "error", err, "timeout", conf.Timeout)
+			return
+		}
+		slog.Debug("Shut down component", "component", name)
+	}
+	step("background workers", w.stop)
+	step("metrics listener", func(ctx context.Context) error {
+		if err := metrics.Shutdown(ctx); err != nil {
+			return errors.Join(err, metrics.Close())
+		}
+		return nil
+	})
+	if tracerClose != nil {
+		step("OTLP trace provider", tracerClose)
+	}
+	step("database connections", func(context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	})
+
+	slog.Info("Shutdown complete")
+}
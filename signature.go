@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/signing"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxSignedBodySize limits the body read to verify a signature, before the request is authenticated
+const maxSignedBodySize = 1 << 20
+
+// signingClientLabel is how a signing client is identified in reports, logs and metrics, distinct from submit token labels
+func signingClientLabel(id string) string {
+	return "hmac:" + id
+}
+
+// verifySignedSubmission authenticates a request signed by a backend (see the signing package),
+// rejecting requests outside of the timestamp window and replays of a nonce
+func verifySignedSubmission(c *gin.Context, clients []config.SigningClient, window time.Duration) {
+	logger := getLogger(c.Request.Context())
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	client := c.GetHeader(signing.HeaderClient)
+	nonce := c.GetHeader(signing.HeaderNonce)
+	timestamp, err := strconv.ParseInt(c.GetHeader(signing.HeaderTimestamp), 10, 64)
+	if client == "" || err != nil || len(nonce) < signing.MinNonceLength || len(nonce) > signing.MaxNonceLength {
+		countSubmitTokenRequest(c, "", "invalid")
+		abortWithProblem(c, http.StatusUnauthorized, codeUnauthorized, fmt.Sprintf(
+			"Signed requests require the %s, %s (Unix seconds), %s (%d to %d characters) and %s headers",
+			signing.HeaderClient, signing.HeaderTimestamp, signing.HeaderNonce, signing.MinNonceLength, signing.MaxNonceLength, signing.HeaderSignature,
+		))
+		return
+	}
+	// unknown clients aren't labelled, so that unauthenticated requests can't create metric series
+	label := ""
+	if slices.ContainsFunc(clients, func(k config.SigningClient) bool { return k.ID == client }) {
+		label = signingClientLabel(client)
+	}
+
+	if skew := time.Since(time.Unix(timestamp, 0)); skew > window || skew < -window {
+		logger.Warn("Signed submission outside of the timestamp window", "client", client, "skew", skew)
+		countSubmitTokenRequest(c, label, "expired")
+		abortWithProblem(c, http.StatusUnauthorized, codeUnauthorized, fmt.Sprintf("%s is more than %s away from the server time", signing.HeaderTimestamp, window))
+		return
+	}
+
+	body, ok := readSignedBody(c)
+	if !ok {
+		return
+	}
+	if !validSignature(c, clients, client, timestamp, nonce, body) {
+		logger.Warn("Submission with an invalid signature", "client", client)
+		countSubmitTokenRequest(c, label, "invalid")
+		abortWithProblem(c, http.StatusUnauthorized, codeUnauthorized, signing.HeaderSignature+" is incorrect, or the client is unknown")
+		return
+	}
+
+	// claim the nonce, relying on the primary key to detect replays
+	err = db.Create(&models.SignatureNonce{Client: client, Nonce: nonce}).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		logger.Warn("Replayed signed submission", "client", client)
+		countSubmitTokenRequest(c, label, "replayed")
+		abortWithProblem(c, http.StatusUnauthorized, codeUnauthorized, signing.HeaderNonce+" was already used")
+		return
+	} else if err != nil {
+		logger.Error("Database write error", "error", err)
+		abortWithProblem(c, http.StatusInternalServerError, codeDatabaseWriteError, "Database write error")
+		return
+	}
+
+	countSubmitTokenRequest(c, label, "accepted")
+	c.Set("submitToken", label)
+	c.Next()
+}
+
+// readSignedBody reads the body to verify its signature, replacing it for the handler.
+// It returns false if the request was aborted, as the body is too large or couldn't be read
+func readSignedBody(c *gin.Context) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSignedBodySize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		abortWithProblem(c, http.StatusRequestEntityTooLarge, codeInvalidBody, fmt.Sprintf("Request body is larger than %d bytes", maxSignedBodySize))
+		return nil, false
+	} else if err != nil {
+		abortWithProblem(c, http.StatusBadRequest, codeInvalidBody, "Failed to read request body")
+		return nil, false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// validSignature checks the request's signature against all keys of the client, which has several while rotating them
+func validSignature(c *gin.Context, clients []config.SigningClient, client string, timestamp int64, nonce string, body []byte) bool {
+	signature := []byte(c.GetHeader(signing.HeaderSignature))
+	valid := false
+	for _, key := range clients {
+		if key.ID == client {
+			expected := signing.Sign([]byte(key.Secret), c.Request.Method, c.Request.URL.RequestURI(), timestamp, nonce, body)
+			valid = valid || hmac.Equal(signature, []byte(expected))
+		}
+	}
+	return valid
+}
+
+// purgeSignatureNonces deletes nonces which can't be replayed anymore, as their requests are outside of the timestamp window.
+// The window is read on each run, as it may be changed by a config reload.
+func purgeSignatureNonces(ctx context.Context, db *gorm.DB, live *liveConfig) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(live.submitAuth.Load().signatureWindow):
+		}
+		window := live.submitAuth.Load().signatureWindow
+		// a request may be first received at the start of its window and replayed at its end
+		result := db.WithContext(ctx).Where("created_at < ?", time.Now().Add(-2*window)).Delete(&models.SignatureNonce{})
+		if result.Error != nil {
+			slog.Error("Failed to purge expired signature nonces", "error", result.Error)
+		} else if result.RowsAffected > 0 {
+			slog.Debug("Purged expired signature nonces", "count", result.RowsAffected)
+		}
+	}
+}
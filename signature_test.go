@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Depado/ginprom"
+	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/Stogas/feedback-api/internal/signing"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestVerifySignedSubmission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// a dry run claims any nonce, so replays aren't covered
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := ginprom.New(ginprom.Registry(prometheus.NewRegistry()))
+	p.AddCustomCounter("submit_token_requests_total", "", []string{"token", "result"})
+	clients := []config.SigningClient{
+		{ID: "billing", Secret: "old-secret-0123456789abcdef012345"},
+		{ID: "billing", Secret: "new-secret-0123456789abcdef012345"},
+		{ID: "shop", Secret: "shop-secret-0123456789abcdef01234"},
+	}
+	live := &liveConfig{}
+	live.submitAuth.Store(&submitAuth{clients: clients, signatureWindow: 5 * time.Minute})
+	now := time.Now().Unix()
+	const nonce = "3q2-7wE4TnKq1Zb8Yw0cRm"
+	const body = `{"satisfied":true}`
+
+	tests := []struct {
+		name       string
+		client     string
+		secret     string
+		timestamp  int64
+		nonce      string
+		signedBody string
+		wantStatus int
+	}{
+		{"valid", "billing", "new-secret-0123456789abcdef012345", now, nonce, body, http.StatusOK},
+		{"previous key while rotating", "billing", "old-secret-0123456789abcdef012345", now, nonce, body, http.StatusOK},
+		{"key of another client", "billing", "shop-secret-0123456789abcdef01234", now, nonce, body, http.StatusUnauthorized},
+		{"unknown client", "crm", "new-secret-0123456789abcdef012345", now, nonce, body, http.StatusUnauthorized},
+		{"altered body", "billing", "new-secret-0123456789abcdef012345", now, nonce, `{"satisfied":false}`, http.StatusUnauthorized},
+		{"timestamp too old", "billing", "new-secret-0123456789abcdef012345", now - 600, nonce, body, http.StatusUnauthorized},
+		{"timestamp in the future", "billing", "new-secret-0123456789abcdef012345", now + 600, nonce, body, http.StatusUnauthorized},
+		{"nonce too short", "billing", "new-secret-0123456789abcdef012345", now, "abc", body, http.StatusUnauthorized},
+		{"no client", "", "new-secret-0123456789abcdef012345", now, nonce, body, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) { c.Set("db", db); c.Set("prom", p) })
+			r.POST("/v1/submit/report", submitTokenMiddleware(live), func(c *gin.Context) {
+				if got := c.GetString("submitToken"); got != "hmac:billing" {
+					t.Errorf("got token label %q", got)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, signedRequest(body, tt.client, tt.secret, tt.timestamp, tt.nonce, tt.signedBody))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// signedRequest builds a submission with the body, signed as if it had signedBody
+func signedRequest(body string, client string, secret string, timestamp int64, nonce string, signedBody string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/submit/report", strings.NewReader(body))
+	req.Header.Set(signing.HeaderClient, client)
+	req.Header.Set(signing.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(signing.HeaderNonce, nonce)
+	req.Header.Set(signing.HeaderSignature, signing.Sign([]byte(secret), http.MethodPost, "/v1/submit/report", timestamp, nonce, []byte(signedBody)))
+	return req
+}
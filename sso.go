@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/Stogas/feedback-api/internal/sso"
+)
+
+// startSSO sets up OIDC login to the admin UI, returning nil if it's disabled
+func startSSO(conf config.OIDCConfig, api config.APIConfig, live *liveConfig, transport http.RoundTripper) *sso.Provider {
+	if conf.IssuerURL == "" {
+		if api.AdminUIEnabled && !api.AdminUIKeyLogin {
+			slog.Warn("API_ADMIN_UI_KEY_LOGIN is disabled without OIDC_ISSUER_URL set, nobody can log in to the admin UI")
+		}
+		return nil
+	}
+	if !api.AdminUIEnabled {
+		slog.Warn("OIDC_ISSUER_URL is set but the admin UI is disabled, set API_ADMIN_UI_ENABLED to log in with OIDC")
+		return nil
+	}
+
+	provider, err := sso.NewProvider(conf, transport)
+	if err != nil {
+		slog.Error("Invalid OIDC configuration", "error", err)
+		panic("invalid OIDC configuration")
+	}
+	live.onSecretsReload(func(conf *config.Config) { provider.SetClientSecret(conf.OIDC.ClientSecret) })
+
+	// discovering right away surfaces misconfiguration early, failures are retried on login
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := provider.Discover(ctx); err != nil {
+			slog.Warn("OIDC provider discovery failed, will retry on login", "error", err, "issuer", conf.IssuerURL)
+			return
+		}
+		slog.Info("OIDC login enabled", "issuer", conf.IssuerURL)
+	}()
+	return provider
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Stogas/feedback-api/internal/config"
+	"github.com/Stogas/feedback-api/internal/dto"
+	"github.com/Stogas/feedback-api/internal/models"
+	"github.com/Stogas/feedback-api/internal/reports"
+	"github.com/Stogas/feedback-api/internal/stream"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// the Postgres channel report events are sent through when shared between replicas
+const reportEventsChannel = "feedback_api_report_events"
+
+// reportEvents publishes report changes to the stream subscribers of this replica,
+// or of all replicas if Postgres LISTEN/NOTIFY is used
+type reportEvents struct {
+	broadcaster *stream.Broadcaster
+	notify      bool
+}
+
+// reportNotification is the payload of a Postgres notification. Reports are read back by
+// the receiving replicas, as they don't fit into the 8000 byte notification payload limit.
+type reportNotification struct {
+	Type string    `json:"type"`
+	UUID uuid.UUID `json:"uuid"`
+}
+
+func eventsMiddleware(events *reportEvents) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("events", events)
+		c.Next()
+	}
+}
+
+// publishReportEvent announces a committed report change to stream subscribers
+func publishReportEvent(c *gin.Context, eventType string, report models.Report) {
+	events := c.MustGet("events").(*reportEvents)
+	if !events.notify {
+		events.broadcaster.Publish(stream.Event{Type: eventType, Report: report})
+		return
+	}
+
+	// the notification is received by this replica too, which publishes it like the others
+	payload, err := json.Marshal(reportNotification{Type: eventType, UUID: report.UUID})
+	if err == nil {
+		db := c.MustGet("db").(*gorm.DB)
+		err = db.Exec("SELECT pg_notify(?, ?)", reportEventsChannel, string(payload)).Error
+	}
+	if err != nil {
+		getLogger(c.Request.Context()).Error("Failed to notify about report event", "error", err, "uuid", report.UUID, "event", eventType)
+	}
+}
+
+// listenReportEvents publishes report events notified by any replica through Postgres, reconnecting on failures
+func listenReportEvents(ctx context.Context, conf config.DBConfig, db *gorm.DB, b *stream.Broadcaster) {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := listenReportEventsOnce(ctx, conf, db, b)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		slog.Error("Listening for report events failed, events are missed until reconnected", "error", err, "retryIn", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+func listenReportEventsOnce(ctx context.Context, conf config.DBConfig, db *gorm.DB, b *stream.Broadcaster) error {
+	connConfig, err := postgresConnConfig(conf)
+	if err != nil {
+		return err
+	}
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return err
+	}
+	// closed with a new context, as ctx is canceled on shutdown
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+reportEventsChannel); err != nil {
+		return err
+	}
+	slog.Info("Listening for report events", "channel", reportEventsChannel)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var n reportNotification
+		if err := json.Unmarshal([]byte(notification.Payload), &n); err != nil {
+			slog.Warn("Ignoring malformed report event", "error", err, "payload", notification.Payload)
+			continue
+		}
+		var report models.Report
+		if err := db.Where("uuid = ?", n.UUID).First(&report).Error; err != nil {
+			slog.Error("Failed to read report of event", "error", err, "uuid", n.UUID, "event", n.Type)
+			continue
+		}
+		b.Publish(stream.Event{Type: n.Type, Report: report})
+	}
+}
+
+// streamReportsEndpoint pushes report events matching the query filters as server-sent events,
+// with a comment sent every keepAlive so that idle connections aren't closed by proxies
+func streamReportsEndpoint(events *reportEvents, keepAlive time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := getLogger(c.Request.Context())
+
+		filter, err := reports.ParseFilter(c.Request.URL.Query())
+		if err != nil {
+			abortWithProblem(c, http.StatusBadRequest, codeInvalidQuery, err.Error())
+			return
+		}
+
+		ch, unsubscribe := events.broadcaster.Subscribe()
+		defer unsubscribe()
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		// disables response buffering of nginx
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		logger.Debug("Report stream opened")
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case e, ok := <-ch:
+				if !ok {
+					// lagging behind or shutting down, clients are expected to reconnect
+					logger.Debug("Report stream closed by server")
+					return false
+				}
+				if filter.Matches(e.Report) {
+					c.SSEvent(e.Type, dto.MapReportToAdminReportResponse(e.Report))
+				}
+				return true
+			case <-ticker.C:
+				_, err := io.WriteString(w, ": keep-alive\n\n")
+				return err == nil
+			}
+		})
+	}
+}
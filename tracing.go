@@ -2,61 +2,240 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
 
 	"github.com/Stogas/feedback-api/internal/config"
 
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-func initTracer(conf config.TraceConfig) (func(), propagation.TextMapPropagator) {
+// otlpHeaders are the OTLP_HEADERS sent with each OTLP/gRPC export, which may be changed by a config reload.
+// OTLP/HTTP exporters can't change their headers, so there they're only applied on restart.
+var otlpHeaders atomic.Pointer[map[string]string]
+
+// otlpHeaderCredentials adds the current OTLP_HEADERS to each OTLP/gRPC export
+type otlpHeaderCredentials struct{}
+
+func (otlpHeaderCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return *otlpHeaders.Load(), nil
+}
+
+// the headers are also sent to collectors without TLS, like with OTEL_EXPORTER_OTLP_HEADERS
+func (otlpHeaderCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// initTracer sets up the global tracer provider, returning a function which flushes and shuts it down.
+// The standard OTEL_* environment variables take precedence over the corresponding OTLP_* settings.
+func initTracer(conf config.TraceConfig) (func(context.Context) error, propagation.TextMapPropagator) {
 	ctx := context.Background()
 
-	// GRPC Exporter
-	exporter, err := otlptracegrpc.New(
-		ctx,
-		otlptracegrpc.WithInsecure(),
-		otlptracegrpc.WithEndpoint(fmt.Sprintf("%s:%v", conf.Host, conf.Port)),
-	)
+	exporter, err := newTraceExporter(ctx, conf)
 	if err != nil {
 		slog.Error("failed to initialize tracer", "error", err)
 		panic("failed to initialize tracer")
 	}
 
-	// HTTP Exporter
-	// exporter, err := otlptracehttp.New(ctx, otlp)
-	// if err != nil {
-	//     return nil, err
-	// }
+	attributes := []attribute.KeyValue{
+		semconv.ServiceName("FeedbackAPI"),
+		semconv.ServiceVersion(version),
+	}
+	if conf.Environment != "" {
+		attributes = append(attributes, semconv.DeploymentEnvironment(conf.Environment))
+	}
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(attributes...),
+		resource.WithTelemetrySDK(),
+		// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES, which override the attributes above
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		slog.Error("failed to initialize tracing resource", "error", err)
+		panic("failed to initialize tracing resource")
+	}
 
-	tp := trace.NewTracerProvider(
-		trace.WithSampler(trace.AlwaysSample()),
+	options := []trace.TracerProviderOption{
 		trace.WithBatcher(exporter),
-		trace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("FeedbackAPI"),
-			semconv.TelemetrySDKLanguageGo,
-		)),
-	)
+		trace.WithResource(res),
+	}
+	// otherwise the provider reads OTEL_TRACES_SAMPLER itself
+	if !otelEnvSet("OTEL_TRACES_SAMPLER") {
+		// traces started by callers are sampled if the caller sampled them, so that they're never incomplete
+		options = append(options, trace.WithSampler(trace.ParentBased(trace.TraceIDRatioBased(conf.SampleRatio))))
+	}
+	tp := trace.NewTracerProvider(options...)
 
-	b3Propagator := b3.New()
-	otel.SetTextMapPropagator(b3Propagator)
+	// OTEL_PROPAGATORS takes precedence, as with the other OTEL_* variables
+	names := conf.Propagators
+	if env := otelEnv("OTEL_PROPAGATORS"); env != "" {
+		names = strings.Split(env, ",")
+	}
+	propagator, err := newPropagator(names)
+	if err != nil {
+		slog.Error("failed to initialize trace propagators", "error", err)
+		panic("failed to initialize trace propagators")
+	}
+	otel.SetTextMapPropagator(propagator)
 
 	otel.SetTracerProvider(tp)
 
-	return func() {
-		slog.Debug("Shutting down OTLP trace provider ...")
-		if err := tp.Shutdown(context.Background()); err != nil {
-			slog.Error("failed to shut down tracer", "error", err)
-			panic("failed to shut down tracer")
+	return tp.Shutdown, propagator
+}
+
+// newPropagator combines the named trace context formats. All of them are injected into outgoing requests,
+// and extracted from incoming ones in order, so that a later format overrides an earlier one present in the same request.
+func newPropagator(names []string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "b3":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "jaeger":
+			propagators = append(propagators, jaeger.Jaeger{})
+		case "none":
+		default:
+			return nil, fmt.Errorf("unsupported propagator %q, expected \"%s\"", name, strings.Join(config.Propagators, `", "`))
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
+
+// newHTTPTransport traces outgoing requests and injects the trace context into them
+func newHTTPTransport(propagator propagation.TextMapPropagator) http.RoundTripper {
+	return otelhttp.NewTransport(http.DefaultTransport, otelhttp.WithPropagators(propagator))
+}
+
+// newTraceExporter creates an OTLP exporter. Options are only passed for settings which aren't set
+// with OTEL_EXPORTER_OTLP_* variables, as options take precedence over those.
+func newTraceExporter(ctx context.Context, conf config.TraceConfig) (trace.SpanExporter, error) {
+	protocol := conf.Protocol
+	if p := otelEnv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"); p != "" {
+		protocol = p
+	}
+	endpoint := otelEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT")
+	endpointSet := endpoint != ""
+	headersSet := otelEnvSet("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "OTEL_EXPORTER_OTLP_HEADERS")
+	// the scheme of an endpoint URL decides whether TLS is used
+	tlsSet := endpointSet || otelEnvSet("OTEL_EXPORTER_OTLP_TRACES_INSECURE", "OTEL_EXPORTER_OTLP_INSECURE",
+		"OTEL_EXPORTER_OTLP_TRACES_CERTIFICATE", "OTEL_EXPORTER_OTLP_CERTIFICATE")
+
+	var tlsConfig *tls.Config
+	if !tlsSet && !conf.Insecure {
+		var err error
+		if tlsConfig, err = traceTLSConfig(conf); err != nil {
+			return nil, err
+		}
+	}
+
+	switch protocol {
+	case "grpc":
+		var options []otlptracegrpc.Option
+		if !endpointSet {
+			endpoint = fmt.Sprintf("%s:%v", conf.Host, conf.Port)
+			options = append(options, otlptracegrpc.WithEndpoint(endpoint))
+		}
+		if !tlsSet {
+			if conf.Insecure {
+				options = append(options, otlptracegrpc.WithInsecure())
+			} else {
+				options = append(options, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+			}
+		}
+		if !headersSet {
+			options = append(options, reloadableOTLPHeaders(conf.Headers))
+		}
+		slog.Info("Exporting traces with OTLP/gRPC", "endpoint", endpoint)
+		return otlptracegrpc.New(ctx, options...)
+	case "http", "http/protobuf":
+		var options []otlptracehttp.Option
+		if !endpointSet {
+			endpoint = fmt.Sprintf("%s:%v", conf.HTTPHost, conf.HTTPPort)
+			options = append(options, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if !tlsSet {
+			if conf.Insecure {
+				options = append(options, otlptracehttp.WithInsecure())
+			} else {
+				options = append(options, otlptracehttp.WithTLSClientConfig(tlsConfig))
+			}
+		}
+		if !headersSet && len(conf.Headers) > 0 {
+			options = append(options, otlptracehttp.WithHeaders(conf.Headers))
+		}
+		slog.Info("Exporting traces with OTLP/HTTP", "endpoint", endpoint)
+		return otlptracehttp.New(ctx, options...)
+	}
+	return nil, fmt.Errorf("unsupported OTLP protocol %q, expected \"grpc\" or \"http/protobuf\"", protocol)
+}
+
+// reloadableOTLPHeaders sends the headers with each OTLP/gRPC export rather than setting them on the exporter,
+// so that a config reload can rotate them
+func reloadableOTLPHeaders(headers map[string]string) otlptracegrpc.Option {
+	otlpHeaders.Store(&headers)
+	reloadableSettings = append(reloadableSettings, "OTLP_HEADERS")
+	return otlptracegrpc.WithDialOption(grpc.WithPerRPCCredentials(otlpHeaderCredentials{}))
+}
+
+// traceTLSConfig verifies the collector with the configured CA, and authenticates with a client certificate if configured
+func traceTLSConfig(conf config.TraceConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if conf.TLSCAFile != "" {
+		ca, err := os.ReadFile(conf.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OTLP CA certificate: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", conf.TLSCAFile)
 		}
-		slog.Debug("OTLP trace provider exited successfully")
-	}, b3Propagator
+	}
+	if conf.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCertFile, conf.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load OTLP client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// otelEnvSet reports whether any of the standard OpenTelemetry variables is set
+func otelEnvSet(names ...string) bool {
+	return otelEnv(names...) != ""
+}
+
+// otelEnv returns the value of the first of the variables which is set, signal-specific ones are listed first
+func otelEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
 }
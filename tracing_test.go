@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewPropagator(t *testing.T) {
+	tests := []struct {
+		name        string
+		propagators []string
+		wantHeaders []string
+		wantErr     bool
+	}{
+		{name: "defaults", propagators: []string{"tracecontext", "baggage", "b3multi"}, wantHeaders: []string{"Traceparent", "X-B3-Traceid", "X-B3-Spanid", "X-B3-Sampled"}},
+		{name: "b3 single header", propagators: []string{"b3"}, wantHeaders: []string{"B3"}},
+		{name: "jaeger", propagators: []string{"jaeger"}, wantHeaders: []string{"Uber-Trace-Id"}},
+		{name: "spaces around names", propagators: []string{" tracecontext "}, wantHeaders: []string{"Traceparent"}},
+		{name: "none", propagators: []string{"none"}},
+		{name: "unknown", propagators: []string{"xray"}, wantErr: true},
+	}
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			propagator, err := newPropagator(tt.propagators)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			header := http.Header{}
+			propagator.Inject(ctx, propagation.HeaderCarrier(header))
+			for _, name := range tt.wantHeaders {
+				if header.Get(name) == "" {
+					t.Errorf("header %s not injected, got %v", name, header)
+				}
+			}
+			if len(tt.wantHeaders) == 0 && len(header) > 0 {
+				t.Errorf("got headers %v, want none", header)
+			}
+
+			// the injected trace context is extracted again
+			extracted := trace.SpanContextFromContext(propagator.Extract(context.Background(), propagation.HeaderCarrier(header)))
+			if len(tt.wantHeaders) > 0 && extracted.TraceID() != spanContext.TraceID() {
+				t.Errorf("got trace ID %s, want %s", extracted.TraceID(), spanContext.TraceID())
+			}
+			if !slices.ContainsFunc(tt.propagators, func(name string) bool { return name != "none" }) && extracted.IsValid() {
+				t.Errorf("got trace context %v, want none", extracted)
+			}
+		})
+	}
+}